@@ -0,0 +1,202 @@
+package convert
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// bundleArchive is an OCI bundle packed as a tar archive, optionally
+// compressed with gzip or zstd. The rootfs is never extracted: the archive
+// is read once to validate the bundle and pick up its configuration, and
+// read again when the rootfs is repacked into a layer.
+type bundleArchive struct {
+	// file is the archive on disk, or a spooled copy of stdin.
+	file  string
+	spool bool
+	// prefix is the directory holding the bundle inside the archive.
+	prefix string
+	// dir is a scratch bundle holding config.json, the ignore file and an
+	// empty rootfs, so that the configuration can be read like any other
+	// bundle directory.
+	dir string
+}
+
+// isBundleArchive reports whether path names an archive rather than a
+// bundle directory. "-" stands for an archive read from stdin.
+func isBundleArchive(path string) bool {
+	if path == "-" {
+		return true
+	}
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// openBundleArchive validates the bundle archive at path.
+func openBundleArchive(path string) (*bundleArchive, error) {
+	b := &bundleArchive{file: path}
+	if path == "-" {
+		f, err := ioutil.TempFile("", "oci2docker-bundle-")
+		if err != nil {
+			return nil, err
+		}
+		b.file, b.spool = f.Name(), true
+		_, err = io.Copy(f, os.Stdin)
+		f.Close()
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("reading bundle from stdin: %v", err)
+		}
+	}
+	if err := b.scan(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// entryName normalizes the name of an archive entry. Names that climb out
+// of the archive are rejected.
+func entryName(name string) (string, error) {
+	name = strings.TrimLeft(name, "/")
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("path %q in archive leaves the bundle", name)
+		}
+	}
+	return path.Clean("./" + name), nil
+}
+
+// open returns a tar reader over the archive. The returned closer must be
+// closed when done.
+func (b *bundleArchive) open() (*tar.Reader, io.Closer, error) {
+	f, err := os.Open(b.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := decompressStream(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %v", b.file, err)
+	}
+	return tar.NewReader(r), multiCloser{r, f}, nil
+}
+
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	for _, c := range m {
+		c.Close()
+	}
+	return nil
+}
+
+// scan checks the bundle layout inside the archive the same way
+// validateBundle checks a directory, and fills the scratch bundle.
+func (b *bundleArchive) scan() error {
+	tr, closer, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	files := make(map[string][]byte)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading the bundle archive: %v", err)
+		}
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		base := path.Base(name)
+		if (base == ConfigFile || base == IgnoreFile) && hdr.Typeflag != tar.TypeDir && strings.Count(name, "/") <= 1 {
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			files[name] = data
+		}
+	}
+
+	config := ""
+	for name := range files {
+		if path.Base(name) == ConfigFile && (config == "" || len(name) < len(config)) {
+			config = name
+		}
+	}
+	if config == "" {
+		return ErrNoConfig
+	}
+	if dir := path.Dir(config); dir != "." {
+		b.prefix = dir + "/"
+	}
+
+	rootfsOK := false
+	for _, name := range names {
+		rpath := strings.TrimPrefix(name, b.prefix)
+		switch {
+		case name == ".", name+"/" == b.prefix, rpath == ConfigFile, rpath == IgnoreFile:
+		case !strings.HasPrefix(name, b.prefix):
+			return fmt.Errorf("unrecognized file path in bundle: %q", name)
+		case rpath == RootfsDir || strings.HasPrefix(rpath, RootfsDir+"/"):
+			rootfsOK = true
+		default:
+			return fmt.Errorf("unrecognized file path in bundle: %q", rpath)
+		}
+	}
+	if !rootfsOK {
+		return ErrNoRootFS
+	}
+
+	if b.dir, err = ioutil.TempDir("", "oci2docker-bundle"); err != nil {
+		return err
+	}
+	if err := os.Mkdir(filepath.Join(b.dir, RootfsDir), 0755); err != nil {
+		return err
+	}
+	for _, f := range []string{ConfigFile, IgnoreFile} {
+		if data, ok := files[b.prefix+f]; ok {
+			if err := ioutil.WriteFile(filepath.Join(b.dir, f), data, 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rootfsName maps an archive entry to its path inside the rootfs. ok is
+// false for entries outside the rootfs and for the rootfs itself.
+func (b *bundleArchive) rootfsName(name string) (string, bool, error) {
+	name, err := entryName(name)
+	if err != nil {
+		return "", false, err
+	}
+	rpath := strings.TrimPrefix(name, b.prefix+RootfsDir+"/")
+	if rpath == name {
+		return "", false, nil
+	}
+	return rpath, true, nil
+}
+
+// Close removes the scratch bundle and any spooled input.
+func (b *bundleArchive) Close() error {
+	if b.dir != "" {
+		os.RemoveAll(b.dir)
+	}
+	if b.spool {
+		os.Remove(b.file)
+	}
+	return nil
+}
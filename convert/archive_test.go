@@ -0,0 +1,170 @@
+package convert
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestArchive writes a bundle archive holding the named entries;
+// names ending in a slash are directories. It is gzipped if compress is
+// set.
+func writeTestArchive(t *testing.T, names []string, compress bool) string {
+	f, err := ioutil.TempFile("", "oci2docker-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if compress {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}
+		content := ""
+		switch {
+		case strings.HasSuffix(name, "/"):
+			hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+		case filepath.Base(name) == ConfigFile:
+			content = `{"ociVersion":"1.0.0"}`
+		default:
+			content = name
+		}
+		hdr.Size = int64(len(content))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f.Name()
+}
+
+func TestOpenBundleArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		compress bool
+		prefix   string
+		files    []string
+		err      string
+	}{
+		{
+			name:    "plain",
+			entries: []string{"config.json", "rootfs/", "rootfs/bin/sh"},
+			files:   []string{ConfigFile},
+		},
+		{
+			name:     "gzip with prefix",
+			entries:  []string{"./", "./bundle/", "./bundle/config.json", "./bundle/.ociignore", "./bundle/rootfs/", "./bundle/rootfs/etc/hosts"},
+			compress: true,
+			prefix:   "bundle/",
+			files:    []string{ConfigFile, IgnoreFile},
+		},
+		{
+			name:    "absolute names",
+			entries: []string{"/config.json", "/rootfs/"},
+			files:   []string{ConfigFile},
+		},
+		{
+			name:    "nested config in rootfs",
+			entries: []string{"config.json", "rootfs/config.json", "rootfs/x/config.json"},
+			files:   []string{ConfigFile},
+		},
+		{
+			name:    "no config",
+			entries: []string{"rootfs/", "rootfs/bin/sh"},
+			err:     ErrNoConfig.Error(),
+		},
+		{
+			name:    "no rootfs",
+			entries: []string{"config.json"},
+			err:     ErrNoRootFS.Error(),
+		},
+		{
+			name:    "stray file",
+			entries: []string{"config.json", "rootfs/", "notes.txt"},
+			err:     `unrecognized file path in bundle: "notes.txt"`,
+		},
+		{
+			name:    "file outside the prefix",
+			entries: []string{"bundle/config.json", "bundle/rootfs/", "other/file"},
+			err:     `unrecognized file path in bundle: "other/file"`,
+		},
+		{
+			name:    "climbing name",
+			entries: []string{"config.json", "rootfs/", "rootfs/../../etc/passwd"},
+			err:     "leaves the bundle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTestArchive(t, tt.entries, tt.compress)
+			defer os.Remove(file)
+			if !isBundleArchive(file) {
+				t.Fatalf("isBundleArchive(%q) = false", file)
+			}
+
+			b, err := openBundleArchive(file)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if b.prefix != tt.prefix {
+				t.Errorf("got prefix %q, want %q", b.prefix, tt.prefix)
+			}
+			if fi, err := os.Stat(filepath.Join(b.dir, RootfsDir)); err != nil || !fi.IsDir() {
+				t.Errorf("scratch bundle has no rootfs directory: %v", err)
+			}
+			for _, f := range tt.files {
+				if _, err := os.Stat(filepath.Join(b.dir, f)); err != nil {
+					t.Errorf("scratch bundle lacks %s: %v", f, err)
+				}
+			}
+			b.Close()
+			if _, err := os.Stat(b.dir); !os.IsNotExist(err) {
+				t.Errorf("Close left the scratch bundle %s", b.dir)
+			}
+		})
+	}
+}
+
+func TestBundleArchiveRootfsName(t *testing.T) {
+	b := &bundleArchive{prefix: "bundle/"}
+	tests := []struct {
+		name  string
+		rpath string
+		ok    bool
+		err   bool
+	}{
+		{name: "bundle/rootfs/bin/sh", rpath: "bin/sh", ok: true},
+		{name: "./bundle/rootfs/etc/", rpath: "etc", ok: true},
+		{name: "/bundle/rootfs/etc/hosts", rpath: "etc/hosts", ok: true},
+		{name: "bundle/rootfs/", ok: false},
+		{name: "bundle/config.json", ok: false},
+		{name: "rootfs/bin/sh", ok: false},
+		{name: "bundle/rootfs/../config.json", err: true},
+	}
+	for _, tt := range tests {
+		rpath, ok, err := b.rootfsName(tt.name)
+		if (err != nil) != tt.err || rpath != tt.rpath || ok != tt.ok {
+			t.Errorf("rootfsName(%q) = %q, %v, %v, want %q, %v", tt.name, rpath, ok, err, tt.rpath, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// knownCapabilities are the Linux capabilities, without their CAP_ prefix.
+var knownCapabilities = map[string]bool{
+	"CHOWN": true, "DAC_OVERRIDE": true, "DAC_READ_SEARCH": true,
+	"FOWNER": true, "FSETID": true, "KILL": true, "SETGID": true,
+	"SETUID": true, "SETPCAP": true, "LINUX_IMMUTABLE": true,
+	"NET_BIND_SERVICE": true, "NET_BROADCAST": true, "NET_ADMIN": true,
+	"NET_RAW": true, "IPC_LOCK": true, "IPC_OWNER": true,
+	"SYS_MODULE": true, "SYS_RAWIO": true, "SYS_CHROOT": true,
+	"SYS_PTRACE": true, "SYS_PACCT": true, "SYS_ADMIN": true,
+	"SYS_BOOT": true, "SYS_NICE": true, "SYS_RESOURCE": true,
+	"SYS_TIME": true, "SYS_TTY_CONFIG": true, "MKNOD": true,
+	"LEASE": true, "AUDIT_WRITE": true, "AUDIT_CONTROL": true,
+	"SETFCAP": true, "MAC_OVERRIDE": true, "MAC_ADMIN": true,
+	"SYSLOG": true, "WAKE_ALARM": true, "BLOCK_SUSPEND": true,
+	"AUDIT_READ": true, "PERFMON": true, "BPF": true,
+	"CHECKPOINT_RESTORE": true,
+}
+
+// dockerCapabilities is the capability set Docker gives containers by
+// default.
+var dockerCapabilities = []string{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL",
+	"MKNOD", "NET_BIND_SERVICE", "NET_RAW", "SETFCAP", "SETGID", "SETPCAP",
+	"SETUID", "SYS_CHROOT",
+}
+
+// normalizeCapability returns the name of a capability without its CAP_
+// prefix, as Docker spells it.
+func normalizeCapability(name string) (string, error) {
+	c := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "CAP_")
+	if !knownCapabilities[c] {
+		return "", fmt.Errorf("unknown capability %q", name)
+	}
+	return c, nil
+}
+
+// diffCapabilities computes the capabilities to add to and drop from
+// Docker's default set so that a container has exactly caps.
+func diffCapabilities(caps []string) (add, drop []string, err error) {
+	want := make(map[string]bool)
+	for _, name := range caps {
+		c, err := normalizeCapability(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		want[c] = true
+	}
+	defaults := make(map[string]bool)
+	for _, c := range dockerCapabilities {
+		defaults[c] = true
+		if !want[c] {
+			drop = append(drop, c)
+		}
+	}
+	for c := range want {
+		if !defaults[c] {
+			add = append(add, c)
+		}
+	}
+	sort.Strings(add)
+	return add, drop, nil
+}
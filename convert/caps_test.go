@@ -0,0 +1,60 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffCapabilities(t *testing.T) {
+	tests := []struct {
+		caps []string
+		add  []string
+		drop []string
+		err  string
+	}{
+		{
+			caps: dockerCapabilities,
+		},
+		{
+			caps: []string{"CAP_AUDIT_WRITE", "cap_chown", "DAC_OVERRIDE", " CAP_FOWNER ", "CAP_FSETID", "CAP_KILL",
+				"CAP_MKNOD", "CAP_NET_BIND_SERVICE", "CAP_NET_RAW", "CAP_SETFCAP", "CAP_SETGID", "CAP_SETPCAP",
+				"CAP_SETUID", "CAP_SYS_CHROOT", "CAP_SYS_ADMIN", "CAP_NET_ADMIN", "CAP_SYS_ADMIN"},
+			add: []string{"NET_ADMIN", "SYS_ADMIN"},
+		},
+		{
+			caps: []string{"CAP_CHOWN", "CAP_KILL"},
+			drop: []string{"AUDIT_WRITE", "DAC_OVERRIDE", "FOWNER", "FSETID", "MKNOD", "NET_BIND_SERVICE",
+				"NET_RAW", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT"},
+		},
+		{
+			caps: nil,
+			drop: dockerCapabilities,
+		},
+		{
+			caps: []string{"CAP_BPF", "CAP_NET_RAW"},
+			add:  []string{"BPF"},
+			drop: []string{"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+				"NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT"},
+		},
+		{caps: []string{"CAP_CHOWN", "CAP_FLY"}, err: `unknown capability "CAP_FLY"`},
+		{caps: []string{"ALL"}, err: `unknown capability "ALL"`},
+		{caps: []string{""}, err: `unknown capability ""`},
+	}
+	for _, tt := range tests {
+		add, drop, err := diffCapabilities(tt.caps)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("diffCapabilities(%q): got error %v, want %q", tt.caps, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("diffCapabilities(%q): %v", tt.caps, err)
+			continue
+		}
+		if !reflect.DeepEqual(add, tt.add) || !reflect.DeepEqual(drop, tt.drop) {
+			t.Errorf("diffCapabilities(%q) = add %q, drop %q, want add %q, drop %q", tt.caps, add, drop, tt.add, tt.drop)
+		}
+	}
+}
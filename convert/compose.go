@@ -0,0 +1,195 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+)
+
+// composeVersion is the compose file format written. 2.4 is the last
+// format with the resource settings of docker run outside swarm mode.
+const composeVersion = "2.4"
+
+type composeFile struct {
+	Version  string                    `json:"version"`
+	Services map[string]composeService `json:"services"`
+}
+
+type composeService struct {
+	Image             string                   `json:"image"`
+	Entrypoint        []string                 `json:"entrypoint,omitempty"`
+	Command           *[]string                `json:"command,omitempty"`
+	NetworkMode       string                   `json:"network_mode,omitempty"`
+	Pid               string                   `json:"pid,omitempty"`
+	Ipc               string                   `json:"ipc,omitempty"`
+	UsernsMode        string                   `json:"userns_mode,omitempty"`
+	Hostname          string                   `json:"hostname,omitempty"`
+	Tty               bool                     `json:"tty,omitempty"`
+	StdinOpen         bool                     `json:"stdin_open,omitempty"`
+	ReadOnly          bool                     `json:"read_only,omitempty"`
+	GroupAdd          []string                 `json:"group_add,omitempty"`
+	CapAdd            []string                 `json:"cap_add,omitempty"`
+	CapDrop           []string                 `json:"cap_drop,omitempty"`
+	SecurityOpt       []string                 `json:"security_opt,omitempty"`
+	Devices           []string                 `json:"devices,omitempty"`
+	DeviceCgroupRules []string                 `json:"device_cgroup_rules,omitempty"`
+	Ulimits           map[string]composeUlimit `json:"ulimits,omitempty"`
+	Sysctls           map[string]string        `json:"sysctls,omitempty"`
+	MemLimit          int64                    `json:"mem_limit,omitempty"`
+	MemReservation    int64                    `json:"mem_reservation,omitempty"`
+	MemswapLimit      int64                    `json:"memswap_limit,omitempty"`
+	MemSwappiness     *int64                   `json:"mem_swappiness,omitempty"`
+	OomKillDisable    bool                     `json:"oom_kill_disable,omitempty"`
+	OomScoreAdj       int                      `json:"oom_score_adj,omitempty"`
+	CPUShares         int64                    `json:"cpu_shares,omitempty"`
+	CPUQuota          int64                    `json:"cpu_quota,omitempty"`
+	CPUPeriod         int64                    `json:"cpu_period,omitempty"`
+	CPURtRuntime      int64                    `json:"cpu_rt_runtime,omitempty"`
+	CPURtPeriod       int64                    `json:"cpu_rt_period,omitempty"`
+	Cpuset            string                   `json:"cpuset,omitempty"`
+	PidsLimit         int64                    `json:"pids_limit,omitempty"`
+	BlkioConfig       *composeBlkio            `json:"blkio_config,omitempty"`
+	ShmSize           int64                    `json:"shm_size,omitempty"`
+	Tmpfs             []string                 `json:"tmpfs,omitempty"`
+	Volumes           []composeVolume          `json:"volumes,omitempty"`
+}
+
+type composeBlkio struct {
+	Weight          uint16                  `json:"weight,omitempty"`
+	WeightDevice    []composeWeightDevice   `json:"weight_device,omitempty"`
+	DeviceReadBps   []composeThrottleDevice `json:"device_read_bps,omitempty"`
+	DeviceWriteBps  []composeThrottleDevice `json:"device_write_bps,omitempty"`
+	DeviceReadIops  []composeThrottleDevice `json:"device_read_iops,omitempty"`
+	DeviceWriteIops []composeThrottleDevice `json:"device_write_iops,omitempty"`
+}
+
+type composeWeightDevice struct {
+	Path   string `json:"path"`
+	Weight uint16 `json:"weight"`
+}
+
+type composeThrottleDevice struct {
+	Path string `json:"path"`
+	Rate uint64 `json:"rate"`
+}
+
+type composeUlimit struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+// composeVolume is a volume in the long syntax of compose files.
+type composeVolume struct {
+	Type     string       `json:"type"`
+	Source   string       `json:"source,omitempty"`
+	Target   string       `json:"target"`
+	ReadOnly bool         `json:"read_only,omitempty"`
+	Bind     *composeBind `json:"bind,omitempty"`
+}
+
+type composeBind struct {
+	Propagation string `json:"propagation"`
+}
+
+// newComposeFile describes rc as the single service of a compose file.
+func newComposeFile(rc *runtimeConfig) composeFile {
+	svc := composeService{
+		Image:       rc.Image,
+		NetworkMode: rc.NetworkMode,
+		Pid:         rc.PidMode,
+		Ipc:         rc.IpcMode,
+		UsernsMode:  rc.UsernsMode,
+		Hostname:    rc.Hostname,
+		Tty:         rc.Tty,
+		StdinOpen:   rc.Tty,
+		ReadOnly:    rc.ReadOnly,
+		CapAdd:      rc.CapAdd,
+		CapDrop:     rc.CapDrop,
+		SecurityOpt: rc.securityOpts(),
+		Sysctls:     rc.Sysctls,
+
+		DeviceCgroupRules: rc.DeviceCgroupRules,
+		MemLimit:          rc.Memory,
+		MemReservation:    rc.MemoryReservation,
+		MemswapLimit:      rc.MemorySwap,
+		MemSwappiness:     rc.MemorySwappiness,
+		OomKillDisable:    rc.OomKillDisable,
+		OomScoreAdj:       rc.OomScoreAdj,
+		CPUShares:         rc.CPUShares,
+		CPUQuota:          rc.CPUQuota,
+		CPUPeriod:         rc.CPUPeriod,
+		CPURtRuntime:      rc.CPURealtimeRuntime,
+		CPURtPeriod:       rc.CPURealtimePeriod,
+		Cpuset:            rc.CpusetCpus,
+		PidsLimit:         rc.PidsLimit,
+		ShmSize:           rc.ShmSize,
+	}
+	if len(rc.Args) > 0 {
+		// The process of the bundle replaces the command of the image.
+		svc.Entrypoint, svc.Command = rc.Args, &[]string{}
+	}
+	if rc.CpusetMems != "" {
+		rc.unsupported("cpuset mems %s", rc.CpusetMems)
+	}
+	if rc.UTSMode != "" {
+		rc.unsupported("UTS namespace mode %s", rc.UTSMode)
+	}
+	if rc.CgroupnsMode == "host" {
+		rc.unsupported("cgroup namespace mode %s", rc.CgroupnsMode)
+	}
+	if rc.KernelMemory != 0 {
+		rc.unsupported("kernel memory limit %d", rc.KernelMemory)
+	}
+	blkio := composeBlkio{
+		Weight:          rc.BlkioWeight,
+		DeviceReadBps:   composeThrottleDevices(rc.BlkioDeviceReadBps),
+		DeviceWriteBps:  composeThrottleDevices(rc.BlkioDeviceWriteBps),
+		DeviceReadIops:  composeThrottleDevices(rc.BlkioDeviceReadIOps),
+		DeviceWriteIops: composeThrottleDevices(rc.BlkioDeviceWriteIOps),
+	}
+	for _, d := range rc.BlkioWeightDevice {
+		blkio.WeightDevice = append(blkio.WeightDevice, composeWeightDevice{Path: d.Path, Weight: d.Weight})
+	}
+	if blkio.Weight != 0 || blkio.WeightDevice != nil || blkio.DeviceReadBps != nil ||
+		blkio.DeviceWriteBps != nil || blkio.DeviceReadIops != nil || blkio.DeviceWriteIops != nil {
+		svc.BlkioConfig = &blkio
+	}
+	for _, gid := range rc.User.AdditionalGids {
+		svc.GroupAdd = append(svc.GroupAdd, fmt.Sprint(gid))
+	}
+	for _, d := range rc.Devices {
+		svc.Devices = append(svc.Devices, d.String())
+	}
+	for _, u := range rc.Ulimits {
+		if svc.Ulimits == nil {
+			svc.Ulimits = make(map[string]composeUlimit)
+		}
+		svc.Ulimits[u.Name] = composeUlimit{Soft: u.Soft, Hard: u.Hard}
+	}
+	for _, m := range rc.Mounts {
+		if m.Type == "tmpfs" {
+			tmpfs := m.Target
+			if len(m.Options) > 0 {
+				tmpfs += ":" + strings.Join(m.Options, ",")
+			}
+			svc.Tmpfs = append(svc.Tmpfs, tmpfs)
+			continue
+		}
+		v := composeVolume{Type: m.Type, Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly}
+		if m.Propagation != "" {
+			v.Bind = &composeBind{Propagation: m.Propagation}
+		}
+		svc.Volumes = append(svc.Volumes, v)
+	}
+	return composeFile{
+		Version:  composeVersion,
+		Services: map[string]composeService{serviceName(rc.Image): svc},
+	}
+}
+
+func composeThrottleDevices(devices []throttleDevice) []composeThrottleDevice {
+	var c []composeThrottleDevice
+	for _, d := range devices {
+		c = append(c, composeThrottleDevice{Path: d.Path, Rate: d.Rate})
+	}
+	return c
+}
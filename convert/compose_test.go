@@ -0,0 +1,123 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestNewComposeFile(t *testing.T) {
+	swappiness := int64(0)
+	tests := []struct {
+		name        string
+		rc          runtimeConfig
+		want        composeService
+		unsupported []string
+	}{
+		{
+			name: "image command",
+			rc:   runtimeConfig{Image: "cts/app:1.0"},
+			want: composeService{Image: "cts/app:1.0"},
+		},
+		{
+			name: "process",
+			rc: runtimeConfig{
+				Image:    "cts/app:1.0",
+				Args:     []string{"/bin/app", "--port", "80"},
+				Hostname: "app",
+				Tty:      true,
+				ReadOnly: true,
+				User:     specs.User{UID: 1000, GID: 1000, AdditionalGids: []uint32{10, 20}},
+			},
+			want: composeService{
+				Image:      "cts/app:1.0",
+				Entrypoint: []string{"/bin/app", "--port", "80"},
+				Command:    &[]string{},
+				Hostname:   "app",
+				Tty:        true,
+				StdinOpen:  true,
+				ReadOnly:   true,
+				GroupAdd:   []string{"10", "20"},
+			},
+		},
+		{
+			name: "mounts and devices",
+			rc: runtimeConfig{
+				Image: "cts/app:1.0",
+				Mounts: []runtimeMount{
+					{Type: "tmpfs", Target: "/tmp"},
+					{Type: "tmpfs", Target: "/run", Options: []string{"ro", "size=1m"}},
+					{Type: "bind", Source: "/srv", Target: "/data", ReadOnly: true, Propagation: "rslave"},
+					{Type: "volume", Target: "/var/lib/app"},
+				},
+				Devices: []deviceMapping{{"/dev/fuse", "/dev/fuse", "rwm"}},
+				Ulimits: []ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+			},
+			want: composeService{
+				Image: "cts/app:1.0",
+				Tmpfs: []string{"/tmp", "/run:ro,size=1m"},
+				Volumes: []composeVolume{
+					{Type: "bind", Source: "/srv", Target: "/data", ReadOnly: true, Bind: &composeBind{Propagation: "rslave"}},
+					{Type: "volume", Target: "/var/lib/app"},
+				},
+				Devices: []string{"/dev/fuse:/dev/fuse:rwm"},
+				Ulimits: map[string]composeUlimit{"nofile": {Soft: 1024, Hard: 4096}},
+			},
+		},
+		{
+			name: "resources",
+			rc: runtimeConfig{
+				Image:              "cts/app:1.0",
+				Memory:             1 << 30,
+				MemorySwappiness:   &swappiness,
+				CPUQuota:           50000,
+				CPUPeriod:          100000,
+				BlkioWeightDevice:  []weightDevice{{Path: "/dev/sda", Weight: 200}},
+				BlkioDeviceReadBps: []throttleDevice{{Path: "/dev/sda", Rate: 1 << 20}},
+			},
+			want: composeService{
+				Image:         "cts/app:1.0",
+				MemLimit:      1 << 30,
+				MemSwappiness: &swappiness,
+				CPUQuota:      50000,
+				CPUPeriod:     100000,
+				BlkioConfig: &composeBlkio{
+					WeightDevice:  []composeWeightDevice{{Path: "/dev/sda", Weight: 200}},
+					DeviceReadBps: []composeThrottleDevice{{Path: "/dev/sda", Rate: 1 << 20}},
+				},
+			},
+		},
+		{
+			name: "unsupported",
+			rc: runtimeConfig{
+				Image:        "cts/app:1.0",
+				CpusetMems:   "0",
+				UTSMode:      "host",
+				CgroupnsMode: "host",
+				KernelMemory: 1 << 20,
+			},
+			want: composeService{Image: "cts/app:1.0"},
+			unsupported: []string{
+				"cpuset mems 0",
+				"UTS namespace mode host",
+				"cgroup namespace mode host",
+				"kernel memory limit 1048576",
+			},
+		},
+	}
+	for _, tt := range tests {
+		rc := tt.rc
+		f := newComposeFile(&rc)
+		if f.Version != composeVersion {
+			t.Errorf("%s: got version %q", tt.name, f.Version)
+		}
+		want := map[string]composeService{"app": tt.want}
+		if !reflect.DeepEqual(f.Services, want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, f.Services, want)
+		}
+		if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+			t.Errorf("%s: got unsupported %q, want %q", tt.name, rc.Unsupported, tt.unsupported)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// Compression is the algorithm used to compress layer blobs.
+type Compression string
+
+const (
+	// CompressionGzip compresses layers with gzip, using all available CPUs.
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd compresses layers with zstd.
+	CompressionZstd Compression = "zstd"
+	// CompressionNone stores layers as plain tar archives.
+	CompressionNone Compression = "none"
+)
+
+// ImageFormat selects the manifest and media types of a written image.
+type ImageFormat string
+
+const (
+	// FormatDocker writes Docker image manifest v2 schema 2 images.
+	FormatDocker ImageFormat = "docker"
+	// FormatOCI writes OCI image-spec images.
+	FormatOCI ImageFormat = "oci"
+)
+
+const (
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerConfig   = "application/vnd.docker.container.image.v1+json"
+	mediaTypeDockerLayer    = "application/vnd.docker.image.rootfs.diff.tar"
+	mediaTypeDockerLayerGz  = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer     = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeOCILayerGz   = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeOCILayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+)
+
+// gzipBlockSize is the amount of uncompressed data handed to each
+// compression worker; gzipDictSize is the deflate window carried over
+// from the previous block so that splitting costs little ratio.
+const (
+	gzipBlockSize = 1 << 20
+	gzipDictSize  = 32 << 10
+)
+
+// ParseCompression checks the compression named on the command line.
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(name); c {
+	case CompressionGzip, CompressionZstd, CompressionNone:
+		return c, nil
+	case "":
+		return CompressionGzip, nil
+	}
+	return "", fmt.Errorf("unknown compression %q, expected gzip, zstd or none", name)
+}
+
+// ParseImageFormat checks the image format named on the command line.
+func ParseImageFormat(name string) (ImageFormat, error) {
+	switch f := ImageFormat(name); f {
+	case FormatDocker, FormatOCI:
+		return f, nil
+	case "":
+		return FormatDocker, nil
+	}
+	return "", fmt.Errorf("unknown image format %q, expected docker or oci", name)
+}
+
+func layerMediaType(format ImageFormat, c Compression) (string, error) {
+	switch format {
+	case FormatDocker:
+		switch c {
+		case CompressionGzip:
+			return mediaTypeDockerLayerGz, nil
+		case CompressionNone:
+			return mediaTypeDockerLayer, nil
+		}
+	case FormatOCI:
+		switch c {
+		case CompressionGzip:
+			return mediaTypeOCILayerGz, nil
+		case CompressionZstd:
+			return mediaTypeOCILayerZstd, nil
+		case CompressionNone:
+			return mediaTypeOCILayer, nil
+		}
+	}
+	return "", fmt.Errorf("%s compression is not supported by the %s image format", c, format)
+}
+
+// newCompressor wraps w so that everything written is compressed with c.
+// Closing the returned writer flushes the stream but does not close w.
+func newCompressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return newParallelGzipWriter(w, runtime.NumCPU()), nil
+	case CompressionZstd:
+		return newZstdWriter(w)
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", c)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// zstdWriter pipes data through the zstd binary, which is multi-threaded
+// and far better tuned than anything we could carry in-tree.
+type zstdWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+func newZstdWriter(w io.Writer) (io.WriteCloser, error) {
+	bin, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, fmt.Errorf("zstd compression requires the zstd binary in PATH: %v", err)
+	}
+	cmd := exec.Command(bin, "-q", "-c", "-T0")
+	cmd.Stdout = w
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting zstd: %v", err)
+	}
+	return &zstdWriter{cmd: cmd, stdin: stdin}, nil
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	return z.stdin.Write(p)
+}
+
+func (z *zstdWriter) Close() error {
+	if err := z.stdin.Close(); err != nil {
+		return err
+	}
+	if err := z.cmd.Wait(); err != nil {
+		return fmt.Errorf("zstd failed: %v", err)
+	}
+	return nil
+}
+
+// parallelGzipWriter produces a single gzip member whose deflate stream is
+// built from independently compressed blocks, the same way pigz does. Each
+// block is primed with the tail of its predecessor and ends on a sync
+// flush, so the concatenation is a valid stream for any gzip reader.
+type parallelGzipWriter struct {
+	w       io.Writer
+	buf     []byte
+	prev    []byte
+	crc     hash.Hash32
+	size    uint32
+	queue   chan chan gzipBlock
+	done    chan struct{}
+	started bool
+	closed  bool
+
+	mu  sync.Mutex
+	err error
+}
+
+type gzipBlock struct {
+	data []byte
+	err  error
+}
+
+func newParallelGzipWriter(w io.Writer, workers int) *parallelGzipWriter {
+	if workers < 1 {
+		workers = 1
+	}
+	z := &parallelGzipWriter{
+		w:     w,
+		buf:   make([]byte, 0, gzipBlockSize),
+		crc:   crc32.NewIEEE(),
+		queue: make(chan chan gzipBlock, workers),
+		done:  make(chan struct{}),
+	}
+	go z.drain()
+	return z
+}
+
+func (z *parallelGzipWriter) setErr(err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.err == nil {
+		z.err = err
+	}
+}
+
+func (z *parallelGzipWriter) getErr() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.err
+}
+
+// drain writes compressed blocks to the underlying writer in input order.
+func (z *parallelGzipWriter) drain() {
+	defer close(z.done)
+	for res := range z.queue {
+		b := <-res
+		if b.err != nil {
+			z.setErr(b.err)
+			continue
+		}
+		if z.getErr() != nil {
+			continue
+		}
+		if _, err := z.w.Write(b.data); err != nil {
+			z.setErr(err)
+		}
+	}
+}
+
+func (z *parallelGzipWriter) Write(p []byte) (int, error) {
+	if !z.started {
+		header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+		if _, err := z.w.Write(header); err != nil {
+			return 0, err
+		}
+		z.started = true
+	}
+	z.crc.Write(p)
+	z.size += uint32(len(p))
+	n := len(p)
+	for len(p) > 0 {
+		room := gzipBlockSize - len(z.buf)
+		if room > len(p) {
+			room = len(p)
+		}
+		z.buf = append(z.buf, p[:room]...)
+		p = p[room:]
+		if len(z.buf) == gzipBlockSize {
+			z.submit(false)
+		}
+	}
+	return n, z.getErr()
+}
+
+func (z *parallelGzipWriter) submit(last bool) {
+	block, dict := z.buf, z.prev
+	if len(block) >= gzipDictSize {
+		z.prev = block[len(block)-gzipDictSize:]
+	} else {
+		z.prev = append(append([]byte{}, dict...), block...)
+		if len(z.prev) > gzipDictSize {
+			z.prev = z.prev[len(z.prev)-gzipDictSize:]
+		}
+	}
+	z.buf = make([]byte, 0, gzipBlockSize)
+
+	res := make(chan gzipBlock, 1)
+	z.queue <- res
+	go func() {
+		var out bytes.Buffer
+		fw, err := flate.NewWriterDict(&out, flate.DefaultCompression, dict)
+		if err == nil {
+			_, err = fw.Write(block)
+		}
+		if err == nil {
+			if last {
+				err = fw.Close()
+			} else {
+				err = fw.Flush()
+			}
+		}
+		res <- gzipBlock{data: out.Bytes(), err: err}
+	}()
+}
+
+// Close flushes the last block and writes the gzip trailer. Closing a
+// closed writer returns the error of the first Close.
+func (z *parallelGzipWriter) Close() error {
+	if z.closed {
+		return z.getErr()
+	}
+	z.closed = true
+	if !z.started {
+		if _, err := z.Write(nil); err != nil {
+			z.setErr(err)
+			return err
+		}
+	}
+	z.submit(true)
+	close(z.queue)
+	<-z.done
+	if err := z.getErr(); err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc.Sum32())
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	if _, err := z.w.Write(trailer[:]); err != nil {
+		z.setErr(err)
+	}
+	return z.getErr()
+}
+
+// decompressStream detects gzip or zstd compression of r by its magic
+// number and returns the plain stream. Uncompressed input is passed through.
+func decompressStream(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return newZstdReader(br)
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+type zstdReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	bin, err := exec.LookPath("zstd")
+	if err != nil {
+		return nil, fmt.Errorf("zstd decompression requires the zstd binary in PATH: %v", err)
+	}
+	cmd := exec.Command(bin, "-q", "-d", "-c")
+	cmd.Stdin = r
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting zstd: %v", err)
+	}
+	return &zstdReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+func (z *zstdReader) Close() error {
+	z.ReadCloser.Close()
+	z.cmd.Wait()
+	return nil
+}
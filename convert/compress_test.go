@@ -0,0 +1,223 @@
+package convert
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// testData returns n bytes that are partly random and partly repetitive, so
+// that both back-references across blocks and literals are exercised.
+func testData(n int) []byte {
+	r := rand.New(rand.NewSource(int64(n)))
+	data := make([]byte, n)
+	for i := 0; i < n; {
+		chunk := 1 + r.Intn(4096)
+		if i+chunk > n {
+			chunk = n - i
+		}
+		if r.Intn(2) == 0 {
+			r.Read(data[i : i+chunk])
+		} else {
+			copy(data[i:i+chunk], strings.Repeat("oci2docker ", chunk/11+1))
+		}
+		i += chunk
+	}
+	return data
+}
+
+func TestParallelGzipWriter(t *testing.T) {
+	sizes := []int{0, 1, gzipDictSize, gzipBlockSize - 1, gzipBlockSize, gzipBlockSize + 1, 3*gzipBlockSize + gzipBlockSize/2}
+	for _, workers := range []int{0, 1, 4} {
+		for _, size := range sizes {
+			data := testData(size)
+			var out bytes.Buffer
+			z := newParallelGzipWriter(&out, workers)
+			// Write in uneven pieces so that blocks straddle writes.
+			for p := data; len(p) > 0; {
+				n := 1000 + len(p)%7777
+				if n > len(p) {
+					n = len(p)
+				}
+				if _, err := z.Write(p[:n]); err != nil {
+					t.Fatalf("workers %d, size %d: write: %v", workers, size, err)
+				}
+				p = p[n:]
+			}
+			if err := z.Close(); err != nil {
+				t.Fatalf("workers %d, size %d: close: %v", workers, size, err)
+			}
+			n := out.Len()
+			if err := z.Close(); err != nil || out.Len() != n {
+				t.Fatalf("workers %d, size %d: second close: %v, wrote %d more bytes", workers, size, err, out.Len()-n)
+			}
+
+			zr, err := gzip.NewReader(&out)
+			if err != nil {
+				t.Fatalf("workers %d, size %d: %v", workers, size, err)
+			}
+			zr.Multistream(false)
+			got, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("workers %d, size %d: read: %v", workers, size, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("workers %d, size %d: got %d bytes back that differ from the input", workers, size, len(got))
+			}
+			if out.Len() != 0 {
+				t.Errorf("workers %d, size %d: %d bytes after the gzip member", workers, size, out.Len())
+			}
+		}
+	}
+}
+
+// failingWriter accepts n bytes, then fails.
+type failingWriter struct {
+	n int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errWriteFailed
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestParallelGzipWriterError(t *testing.T) {
+	data := testData(2*gzipBlockSize + 10)
+	for _, n := range []int{0, 10, 100} {
+		z := newParallelGzipWriter(&failingWriter{n: n}, 2)
+		_, werr := z.Write(data)
+		cerr := z.Close()
+		if werr != errWriteFailed && cerr != errWriteFailed {
+			t.Errorf("writer failing after %d bytes: got write error %v and close error %v", n, werr, cerr)
+		}
+		if err := z.Close(); err != cerr {
+			t.Errorf("writer failing after %d bytes: second close returned %v, the first %v", n, err, cerr)
+		}
+	}
+}
+
+func TestDecompressStream(t *testing.T) {
+	data := testData(100000)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(data)
+	zw.Close()
+
+	tests := []struct {
+		name  string
+		input []byte
+		zstd  bool
+	}{
+		{name: "plain", input: data},
+		{name: "empty", input: nil},
+		{name: "short", input: []byte{0x1f}},
+		{name: "gzip", input: gz.Bytes()},
+		{name: "zstd", zstd: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, want := tt.input, tt.input
+			if tt.name == "gzip" {
+				want = data
+			}
+			if tt.zstd {
+				if _, err := exec.LookPath("zstd"); err != nil {
+					t.Skip("zstd binary not found")
+				}
+				var buf bytes.Buffer
+				zw, err := newZstdWriter(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				zw.Write(data)
+				if err := zw.Close(); err != nil {
+					t.Fatal(err)
+				}
+				input, want = buf.Bytes(), data
+			}
+			r, err := decompressStream(bytes.NewReader(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes, want %d", len(got), len(want))
+			}
+		})
+	}
+
+	// A truncated gzip stream must fail rather than end early.
+	r, err := decompressStream(bytes.NewReader(gz.Bytes()[:gz.Len()/2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err == nil {
+		t.Errorf("truncated gzip stream read without error")
+	}
+}
+
+func TestLayerMediaType(t *testing.T) {
+	tests := []struct {
+		format ImageFormat
+		c      Compression
+		want   string
+		err    string
+	}{
+		{FormatDocker, CompressionGzip, mediaTypeDockerLayerGz, ""},
+		{FormatDocker, CompressionNone, mediaTypeDockerLayer, ""},
+		{FormatDocker, CompressionZstd, "", "zstd compression is not supported by the docker image format"},
+		{FormatOCI, CompressionGzip, mediaTypeOCILayerGz, ""},
+		{FormatOCI, CompressionZstd, mediaTypeOCILayerZstd, ""},
+		{FormatOCI, CompressionNone, mediaTypeOCILayer, ""},
+	}
+	for _, tt := range tests {
+		got, err := layerMediaType(tt.format, tt.c)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("layerMediaType(%s, %s): got error %v, want %q", tt.format, tt.c, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("layerMediaType(%s, %s) = %q, %v, want %q", tt.format, tt.c, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		name string
+		want Compression
+		err  bool
+	}{
+		{"", CompressionGzip, false},
+		{"gzip", CompressionGzip, false},
+		{"zstd", CompressionZstd, false},
+		{"none", CompressionNone, false},
+		{"bzip2", "", true},
+		{"GZIP", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCompression(tt.name)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseCompression(%q) = %q, %v", tt.name, got, err)
+		}
+	}
+}
@@ -1,19 +1,24 @@
 package convert
 
 import (
+	"archive/tar"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"text/template"
+	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	specs "github.com/opencontainers/specs/specs-go"
 )
 
-// DockerInfo stores data for generating Dockerfile.
+// DockerInfo stores data for generating Dockerfile. Dockerfile templates
+// are executed with it.
 type DockerInfo struct {
 	Appdir      string
 	Entrypoint  string
@@ -28,55 +33,301 @@ type DockerInfo struct {
 	Cmd         bool
 	Usr         bool
 	Cwd         bool
+
+	// Spec is the complete configuration of the bundle.
+	Spec *specs.Spec
+	// Config is the image configuration the bundle maps to, the same one
+	// written by --output.
+	Config containerConfig
+	// Platform is the OS and architecture of the image.
+	Platform platform
 }
 
 const (
-	buildTemplate = `
-FROM scratch
-MAINTAINER ChengTiesheng <chengtiesheng@huawei.com>
-{{if .Add}}
-ADD {{.Appdir}} .
-{{end}}
-{{if .Env}} 
-ENV {{.Environment}}
-{{end}}
-{{if .Usr}}
-USER {{.User}}
-{{end}}
-{{if .Cwd}}
-WORKDIR {{.Workdir}}
-{{end}}
-{{if .Cmd}}
-CMD {{.Command}}
-{{end}}
-ENTRYPOINT ["{{.Entrypoint}}"]
-{{if .Port}}
-EXPOSE {{.Expose}}
-{{end}}
-`
+	buildTemplate = `FROM scratch
+{{range $name, $value := .Config.Labels}}LABEL {{kv $name $value}}
+{{end}}{{if .Add}}ADD {{.Appdir}} .
+{{end}}{{range .Config.Env}}ENV {{env .}}
+{{end}}{{with .Config.User}}USER {{.}}
+{{end}}{{with .Config.WorkingDir}}WORKDIR {{.}}
+{{end}}{{with .Config.Cmd}}CMD {{json .}}
+{{end}}{{with .Config.Entrypoint}}ENTRYPOINT {{json .}}
+{{end}}{{if .Port}}EXPOSE {{.Expose}}
+{{end}}`
 )
 
-// RunOCI2Docker is the entrypoint for oci2docker CLI tool.
-func RunOCI2Docker(path string, flagDebug bool, imgName string, port string) {
-	if flagDebug {
+// Options holds the settings of a single conversion.
+type Options struct {
+	// Debug enables debug messages and docker build output.
+	Debug bool
+	// ImageNames are the references the generated image is tagged with.
+	// Names without a tag get the default tag of the bundle.
+	ImageNames []string
+	// Ports are the exposed ports of the image as port/protocol, added to
+	// those named by the bundle annotations.
+	Ports []string
+	// Output is an image layout directory to write the image to. When it
+	// is empty the image is built by the local docker daemon instead.
+	Output string
+	// Format selects Docker or OCI manifests and media types for Output.
+	Format ImageFormat
+	// Compression is the algorithm used for layer blobs written to Output.
+	Compression Compression
+	// IgnoreFile lists rootfs paths to leave out of the image, in
+	// .dockerignore syntax. It defaults to IgnoreFile in the bundle.
+	IgnoreFile string
+	// UIDMappings and GIDMappings shift rootfs ownership from host IDs to
+	// container IDs in written layers. They default to the uidMappings
+	// and gidMappings of the bundle.
+	UIDMappings []specs.IDMapping
+	GIDMappings []specs.IDMapping
+	// StrictRootfs fails the conversion when the rootfs contains setuid
+	// files, escaping symlinks or other suspicious entries, instead of
+	// only reporting them.
+	StrictRootfs bool
+	// Push lists registry references to upload the image to.
+	Push []string
+	// MountFrom lists repositories on the push registry to mount existing
+	// blobs from instead of uploading them.
+	MountFrom []string
+	// InsecureRegistry pushes over plain HTTP. Registries on localhost are
+	// always reached over HTTP.
+	InsecureRegistry bool
+	// Template is a Go template file replacing the built-in Dockerfile
+	// template. It is executed with a DockerInfo.
+	Template string
+	// AllowAllDevices lets the runtime settings give the container access
+	// to every device of the host when the bundle asks for it.
+	AllowAllDevices bool
+
+	// archive is set when the bundle was given as an archive.
+	archive *bundleArchive
+}
+
+func setLogLevel(debug bool) {
+	if debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	} else {
 		logrus.SetLevel(logrus.InfoLevel)
 	}
+}
 
+// openBundle validates the bundle at path. Bundle archives are opened and
+// the path of their scratch bundle is returned; the caller must close the
+// archive when done.
+func openBundle(path string) (string, *bundleArchive, error) {
+	var archive *bundleArchive
+	if isBundleArchive(path) {
+		var err error
+		if archive, err = openBundleArchive(path); err != nil {
+			return "", nil, fmt.Errorf("invalid oci bundle archive %s: %v", path, err)
+		}
+		path = archive.dir
+	}
 	if bValidate := validateOCIProc(path); bValidate != true {
-		logrus.Infof("Invalid oci bundle.")
+		if archive != nil {
+			archive.Close()
+		}
+		return "", nil, fmt.Errorf("invalid oci bundle")
+	}
+	return path, archive, nil
+}
+
+// publishImage stores the image or image index desc written to opts.Output,
+// pushing it when a push destination is set.
+func publishImage(desc descriptor, opts Options) {
+	if len(opts.Push) == 0 {
+		logrus.Infof("Image %s (%s) written to %s.", strings.Join(opts.ImageNames, ", "), desc.Digest, opts.Output)
+		return
+	}
+	for _, ref := range opts.Push {
+		if err := pushImage(&imageLayout{dir: opts.Output}, desc, ref, opts); err != nil {
+			logrus.Infof("Push image failed: %v", err)
+			return
+		}
+	}
+}
+
+// tempOutput points opts.Output to a temporary image layout when the image
+// is only pushed. The returned function removes it.
+func tempOutput(opts *Options) (func(), error) {
+	if len(opts.Push) == 0 || opts.Output != "" {
+		return func() {}, nil
+	}
+	dir, err := ioutil.TempDir("", "oci2docker-image")
+	if err != nil {
+		return nil, fmt.Errorf("create image layout failed: %v", err)
+	}
+	opts.Output = dir
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// RunOCI2Docker is the entrypoint for oci2docker CLI tool.
+func RunOCI2Docker(path string, opts Options) {
+	flagDebug := opts.Debug
+	setLogLevel(flagDebug)
+
+	path, archive, err := openBundle(path)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	if archive != nil {
+		defer archive.Close()
+		opts.archive = archive
+	}
+	if err := tagImageNames(path, &opts); err != nil {
+		logrus.Infof("%v", err)
 		return
 	}
 
+	cleanup, err := tempOutput(&opts)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	defer cleanup()
+
+	if opts.Output != "" {
+		desc, err := writeImage(path, opts)
+		if err != nil {
+			logrus.Infof("Write image failed: %v", err)
+			return
+		}
+		publishImage(desc, opts)
+		return
+	}
+
+	if err := buildImage(path, opts); err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	logrus.Infof("Docker image %s generated successfully.", strings.Join(opts.ImageNames, ", "))
+}
+
+// buildImage builds the bundle at path with the local docker daemon and
+// tags the image with the image names of opts. The build context is
+// streamed to docker build, the rootfs entries straight from the bundle.
+func buildImage(path string, opts Options) error {
+	c, err := newBuildContext(path, opts)
+	if err != nil {
+		return fmt.Errorf("write build context failed: %v", err)
+	}
+
+	args := []string{"build"}
+	for _, name := range opts.ImageNames {
+		args = append(args, "-t", name)
+	}
+	cmd := exec.Command("docker", append(args, "-")...)
+	pr, pw := io.Pipe()
+	cmd.Stdin = pr
+	werr := make(chan error, 1)
+	go func() {
+		err := c.writeTar(pw)
+		pw.CloseWithError(err)
+		werr <- err
+	}()
+	logrus.Debugf("Docker build log is:")
+
+	if opts.Debug {
+		err = run(cmd)
+	} else {
+		cmd.Stderr = os.Stderr
+		err = cmd.Run()
+	}
+	pr.Close()
+	if cerr := <-werr; cerr != nil && cerr != io.ErrClosedPipe {
+		return fmt.Errorf("write build context failed: %v", cerr)
+	}
+	if err != nil {
+		return fmt.Errorf("docker build failed: %v", err)
+	}
+	return nil
+}
+
+// RunDockerfile writes the Dockerfile and rootfs of the bundle at path to
+// dir, a docker build context for other build tools. dir must not exist
+// or be empty.
+func RunDockerfile(path, dir string, opts Options) {
+	setLogLevel(opts.Debug)
+
+	path, archive, err := openBundle(path)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	if archive != nil {
+		defer archive.Close()
+		opts.archive = archive
+	}
+
+	if names, err := ioutil.ReadDir(dir); err == nil && len(names) > 0 {
+		logrus.Infof("Build context directory %s is not empty.", dir)
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logrus.Infof("Create build context failed: %v", err)
+		return
+	}
+	if err := writeBuildContext(path, dir, opts); err != nil {
+		logrus.Infof("Write build context failed: %v", err)
+		os.RemoveAll(dir)
+		return
+	}
+	logrus.Infof("Build context written to %s.", dir)
+}
+
+// writeBuildContext checks the bundle at path and writes a self-contained
+// docker build context for it to dir: the Dockerfile and the rootfs it
+// adds.
+func writeBuildContext(path, dir string, opts Options) error {
+	c, err := newBuildContext(path, opts)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), c.dockerfile, 0644); err != nil {
+		return fmt.Errorf("error writing Dockerfile: %v", err)
+	}
+	return c.rootfs.copyRootfs(filepath.Join(dir, RootfsDir))
+}
+
+// buildContext is the docker build context of a bundle: the generated
+// Dockerfile and the rootfs it adds.
+type buildContext struct {
+	dockerfile []byte
+	rootfs     *archiver
+}
+
+// newBuildContext checks the bundle at path and generates its Dockerfile.
+func newBuildContext(path string, opts Options) (*buildContext, error) {
+	t, err := loadTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := newImageConfig(path, opts.Ports)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newArchiver(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRootfs(path, a); err != nil {
+		return nil, err
+	}
+	if len(a.uidMap) > 0 || len(a.gidMap) > 0 {
+		logrus.Warnf("Docker build makes root the owner of the added rootfs, so the uid/gid mappings are lost; convert with --output to keep the mapped owners.")
+	}
+
 	appdir := getRootPathFromSpecs(path)
 	entrypoint, workdir := getEntrypointFromSpecs(path)
 	env := getEnvFromSpecs(path)
 	command := getPoststartFromSpecs(path)
 	user := getUserFromSpecs(path)
 
+	expose := formatPorts(cfg.Config.ExposedPorts)
 	bPort := false
-	if port != "" {
+	if expose != "" {
 		bPort = true
 	}
 
@@ -88,7 +339,7 @@ func RunOCI2Docker(path string, flagDebug bool, imgName string, port string) {
 	bAdd := false
 	if appdir != "" {
 		bAdd = true
-		appdir = "./" + appdir
+		appdir = "./" + RootfsDir
 	}
 
 	bCmd := false
@@ -109,7 +360,7 @@ func RunOCI2Docker(path string, flagDebug bool, imgName string, port string) {
 	dockerInfo := DockerInfo{
 		Appdir:      appdir,
 		Entrypoint:  entrypoint,
-		Expose:      port,
+		Expose:      expose,
 		Environment: env,
 		Workdir:     workdir,
 		Command:     command,
@@ -120,69 +371,38 @@ func RunOCI2Docker(path string, flagDebug bool, imgName string, port string) {
 		Cmd:         bCmd,
 		Usr:         bUsr,
 		Cwd:         bCwd,
+		Spec:        getConfigSpec(path),
+		Config:      cfg.Config,
+		Platform:    platform{Architecture: cfg.Architecture, OS: cfg.OS},
 	}
 
-	generateDockerfile(dockerInfo)
-
-	dirWork := createWorkDir()
-
-	err := run(exec.Command("mv", "./Dockerfile", dirWork+"/Dockerfile"))
-	if err != nil {
-		logrus.Debugf("Store Dockerfile failed: %v", err)
-	}
-	err = run(exec.Command("cp", "-rf", path+"/rootfs", dirWork))
-	if err != nil {
-		logrus.Debugf("Store rootfs failed: %v", err)
-	}
-
-	buildOut := ""
-	if flagDebug == false {
-		buildOut = " > /dev/null"
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, dockerInfo); err != nil {
+		return nil, fmt.Errorf("error generating Dockerfile: %v", err)
 	}
-	cmdStr := fmt.Sprintf("docker build -t %s %s %s", imgName, dirWork, buildOut)
-	logrus.Debugf("Docker build log is:")
-
-	err = run(exec.Command("/bin/sh", "-c", cmdStr))
-	if err != nil {
-		logrus.Debugf("Docker build failed: %v", err)
-	} else {
-		logrus.Infof("Docker image %v generated successfully.", imgName)
-	}
-
-	return
+	return &buildContext{dockerfile: buf.Bytes(), rootfs: a}, nil
 }
 
-func generateDockerfile(dockerInfo DockerInfo) {
-	t := template.Must(template.New("buildTemplate").Parse(buildTemplate))
-
-	f, err := os.Create("Dockerfile")
-	if err != nil {
-		logrus.Debugf("Error wrinting Dockerfile %v", err.Error())
-		return
+// writeTar writes the build context as a tar stream, the form docker build
+// reads from its standard input.
+func (c *buildContext) writeTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	hdr := &tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(c.dockerfile)), ModTime: now, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
 	}
-	defer f.Close()
-
-	t.Execute(f, dockerInfo)
-
-	return
-}
-
-// Create work directory for the conversion output
-func createWorkDir() string {
-	idir, err := ioutil.TempDir("", "oci2docker")
-	if err != nil {
-		return ""
+	if _, err := tw.Write(c.dockerfile); err != nil {
+		return err
 	}
-	rootfs := filepath.Join(idir, "rootfs")
-	os.MkdirAll(rootfs, 0755)
-
-	data := []byte{}
-	if err := ioutil.WriteFile(filepath.Join(idir, "Dockerfile"), data, 0644); err != nil {
-		return ""
+	hdr = &tar.Header{Name: RootfsDir + "/", Mode: 0755, ModTime: now, Typeflag: tar.TypeDir}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
 	}
-
-	logrus.Debugf("Docker build context is in %s\n", idir)
-	return idir
+	if err := c.rootfs.writeEntries(tw, RootfsDir+"/"); err != nil {
+		return err
+	}
+	return tw.Close()
 }
 
 func getConfigSpec(path string) *specs.Spec {
@@ -214,7 +434,7 @@ func getEntrypointFromSpecs(path string) (string, string) {
 
 	workDir := spec.Process.Cwd
 	entryPoint := spec.Process.Args
-	if entryPoint == nil {
+	if len(entryPoint) == 0 {
 		return "/bin/sh", ""
 	}
 
@@ -259,7 +479,7 @@ func getUserFromSpecs(path string) string {
 	uid := fmt.Sprintf("%d", spec.Process.User.UID)
 	gid := fmt.Sprintf("%d", spec.Process.User.GID)
 
-	user := uid + "/" + gid
+	user := uid + ":" + gid
 
 	return user
 }
@@ -0,0 +1,132 @@
+package convert
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBuildContext(t *testing.T) {
+	bundle := writePlatformBundle(t, "linux", "amd64", "amd64", "PATH=/bin")
+	defer os.RemoveAll(bundle)
+	if err := ioutil.WriteFile(filepath.Join(bundle, RootfsDir, "debug.log"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, IgnoreFile), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mismatch := writePlatformBundle(t, "linux", "arm64", "amd64")
+	defer os.RemoveAll(mismatch)
+
+	tests := []struct {
+		name  string
+		path  string
+		ports []string
+		want  string
+		err   string
+	}{
+		{
+			name:  "bundle",
+			path:  bundle,
+			ports: []string{"8080/tcp"},
+			want: `FROM scratch
+ADD ./rootfs .
+ENV PATH="/bin"
+USER 0:0
+WORKDIR /
+ENTRYPOINT ["/bin/app"]
+EXPOSE 8080/tcp
+`,
+		},
+		{name: "failed check", path: mismatch, err: "platform.arch is arm64"},
+		{name: "no config", path: filepath.Join(bundle, RootfsDir), err: ErrNoConfig.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "oci2docker-context")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			err = writeBuildContext(tt.path, dir, Options{Ports: tt.ports})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				if _, err := os.Stat(filepath.Join(dir, "Dockerfile")); err == nil {
+					t.Errorf("a failed check wrote the Dockerfile")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got Dockerfile\n%s\nwant\n%s", data, tt.want)
+			}
+			fi, err := os.Stat(filepath.Join(dir, RootfsDir, "bin/app"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0755 {
+				t.Errorf("got mode %v for /bin/app, want 0755", fi.Mode().Perm())
+			}
+			if _, err := os.Stat(filepath.Join(dir, RootfsDir, "debug.log")); !os.IsNotExist(err) {
+				t.Errorf("the build context holds an ignored file: %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildContextTar(t *testing.T) {
+	bundle := writePlatformBundle(t, "linux", "amd64", "amd64")
+	defer os.RemoveAll(bundle)
+	if err := os.Link(filepath.Join(bundle, RootfsDir, "bin/app"), filepath.Join(bundle, RootfsDir, "bin/link")); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newBuildContext(bundle, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.writeTar(&buf); err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name == "Dockerfile" {
+			data, _ := ioutil.ReadAll(tr)
+			if !bytes.Equal(data, c.dockerfile) {
+				t.Errorf("got Dockerfile\n%s\nwant\n%s", data, c.dockerfile)
+			}
+		}
+		entries[hdr.Name] = hdr
+	}
+	for _, name := range []string{"Dockerfile", "rootfs/", "rootfs/bin/", "rootfs/bin/app", "rootfs/bin/link"} {
+		if entries[name] == nil {
+			t.Errorf("the build context lacks %s", name)
+		}
+	}
+	if hdr := entries["rootfs/bin/link"]; hdr != nil && (hdr.Typeflag != tar.TypeLink || hdr.Linkname != "rootfs/bin/app") {
+		t.Errorf("got hard link to %q, want rootfs/bin/app", hdr.Linkname)
+	}
+}
@@ -0,0 +1,141 @@
+package convert
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// newCreateRequest describes a container of rc for the Engine API. The
+// process of the bundle replaces the command of the image. When attach is
+// set the standard streams of the container are attached.
+func newCreateRequest(rc *runtimeConfig, attach bool) createRequest {
+	return createRequest{
+		Image:        rc.Image,
+		Hostname:     rc.Hostname,
+		User:         fmt.Sprintf("%d:%d", rc.User.UID, rc.User.GID),
+		Env:          rc.Env,
+		Entrypoint:   rc.Args,
+		Cmd:          []string{},
+		WorkingDir:   rc.Cwd,
+		Tty:          rc.Tty,
+		OpenStdin:    rc.Tty || attach,
+		StdinOnce:    attach,
+		AttachStdin:  attach,
+		AttachStdout: attach,
+		AttachStderr: attach,
+		HostConfig:   newHostConfig(rc),
+	}
+}
+
+// RunCreate converts the bundle at path into an image with the local
+// docker daemon, then creates a container named name from it with the
+// runtime settings of the bundle and prints its ID. The container is
+// started when start is set; attach also starts it and copies its
+// standard streams until it exits. It returns the exit status of the
+// command: that of the container when attached, 1 when anything failed.
+func RunCreate(path, name string, start, attach bool, opts Options) int {
+	setLogLevel(opts.Debug)
+
+	status, err := runCreate(path, name, start, attach, opts)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return 1
+	}
+	return status
+}
+
+func runCreate(path, name string, start, attach bool, opts Options) (int, error) {
+	path, archive, err := openBundle(path)
+	if err != nil {
+		return 0, err
+	}
+	if archive != nil {
+		defer archive.Close()
+		opts.archive = archive
+	}
+	if err := tagImageNames(path, &opts); err != nil {
+		return 0, err
+	}
+	spec := getConfigSpec(path)
+	if spec == nil {
+		return 0, ErrNoConfig
+	}
+
+	stat, err := bundleRootfsStat(path, spec, opts)
+	if err != nil {
+		return 0, err
+	}
+	rc, err := newRuntimeConfig(spec, stat, opts)
+	if err != nil {
+		return 0, fmt.Errorf("Runtime configuration failed: %v", err)
+	}
+	req := newCreateRequest(rc, attach)
+	for _, u := range rc.Unsupported {
+		logrus.Warnf("Not expressible in Docker: %s.", u)
+	}
+	client, err := newEngineClient()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := buildImage(path, opts); err != nil {
+		return 0, err
+	}
+	id, warnings, err := client.createContainer(name, req)
+	if err != nil {
+		return 0, fmt.Errorf("Create container failed: %v", err)
+	}
+	for _, w := range warnings {
+		logrus.Warnf("%s", w)
+	}
+	fmt.Println(id)
+
+	switch {
+	case attach:
+		status, err := attachContainer(client, id, rc.Tty)
+		if err != nil {
+			return 0, fmt.Errorf("Attach container failed: %v", err)
+		}
+		logrus.Infof("Container %s exited with status %d.", id, status)
+		return status, nil
+	case start:
+		if err := client.startContainer(id); err != nil {
+			return 0, fmt.Errorf("Start container failed: %v", err)
+		}
+	}
+	return 0, nil
+}
+
+// attachContainer attaches to container id, starts it and copies its
+// standard streams until it exits. It returns the exit status.
+func attachContainer(client *engineClient, id string, tty bool) (int, error) {
+	conn, output, err := client.attachContainer(id)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := client.startContainer(id); err != nil {
+		return 0, err
+	}
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		if c, ok := conn.(interface {
+			CloseWrite() error
+		}); ok {
+			c.CloseWrite()
+		}
+	}()
+	if tty {
+		_, err = io.Copy(os.Stdout, output)
+	} else {
+		err = demuxStreams(output, os.Stdout, os.Stderr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return client.waitContainer(id)
+}
@@ -0,0 +1,95 @@
+package convert
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestNewCreateRequest(t *testing.T) {
+	rc := &runtimeConfig{
+		Image:    "cts/app:1.0",
+		Args:     []string{"/bin/app", "-v"},
+		Env:      []string{"PATH=/bin"},
+		Cwd:      "/srv",
+		User:     specs.User{UID: 1000, GID: 100},
+		Hostname: "app",
+		ReadOnly: true,
+	}
+	tests := []struct {
+		name   string
+		tty    bool
+		attach bool
+		want   createRequest
+	}{
+		{
+			name: "detached",
+			want: createRequest{
+				Image:      "cts/app:1.0",
+				Hostname:   "app",
+				User:       "1000:100",
+				Env:        []string{"PATH=/bin"},
+				Entrypoint: []string{"/bin/app", "-v"},
+				Cmd:        []string{},
+				WorkingDir: "/srv",
+				HostConfig: hostConfig{ReadonlyRootfs: true},
+			},
+		},
+		{
+			name: "terminal",
+			tty:  true,
+			want: createRequest{
+				Image:      "cts/app:1.0",
+				Hostname:   "app",
+				User:       "1000:100",
+				Env:        []string{"PATH=/bin"},
+				Entrypoint: []string{"/bin/app", "-v"},
+				Cmd:        []string{},
+				WorkingDir: "/srv",
+				Tty:        true,
+				OpenStdin:  true,
+				HostConfig: hostConfig{ReadonlyRootfs: true},
+			},
+		},
+		{
+			name:   "attached",
+			attach: true,
+			want: createRequest{
+				Image:        "cts/app:1.0",
+				Hostname:     "app",
+				User:         "1000:100",
+				Env:          []string{"PATH=/bin"},
+				Entrypoint:   []string{"/bin/app", "-v"},
+				Cmd:          []string{},
+				WorkingDir:   "/srv",
+				OpenStdin:    true,
+				StdinOnce:    true,
+				AttachStdin:  true,
+				AttachStdout: true,
+				AttachStderr: true,
+				HostConfig:   hostConfig{ReadonlyRootfs: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		rc.Tty = tt.tty
+		if got := newCreateRequest(rc, tt.attach); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunCreateStatus(t *testing.T) {
+	bundle, err := ioutil.TempDir("", "oci2docker-create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundle)
+
+	if status := RunCreate(bundle, "", false, false, Options{ImageNames: []string{"cts/app:1.0"}}); status != 1 {
+		t.Errorf("got status %d for a bundle without config.json, want 1", status)
+	}
+}
@@ -0,0 +1,179 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// deviceAccess lists the cgroup access types in the order Docker writes
+// them.
+const deviceAccess = "rwm"
+
+// mapDevices maps the device nodes and the device cgroup rules of the
+// bundle. Docker starts from a cgroup that denies every device but a
+// default set, so the leading deny-all rule of the bundle is implied;
+// allow rules covered by a device node are implied by its permissions.
+// An allow-all rule is refused unless allowAll is set.
+func (rc *runtimeConfig) mapDevices(spec *specs.Spec, allowAll bool) error {
+	var rules []specs.DeviceCgroup
+	if spec.Linux.Resources != nil {
+		rules = spec.Linux.Resources.Devices
+	}
+	for i, r := range rules {
+		if r.Allow && isAllDevices(r) && !allowAll {
+			return fmt.Errorf("linux.resources.devices[%d] allows access to all devices of the host, which needs --allow-all-devices", i)
+		}
+	}
+
+	for _, d := range spec.Linux.Devices {
+		typ := d.Type
+		if typ == "u" {
+			typ = "c"
+		}
+		if typ != "c" && typ != "b" {
+			rc.unsupported("device %s of type %q", d.Path, d.Type)
+			continue
+		}
+		// Runtimes give full access to the device nodes they create,
+		// so a node the rules do not grant anything keeps rwm.
+		perms := devicePermissions(rules, typ, d.Major, d.Minor)
+		if perms == "" {
+			perms = deviceAccess
+		}
+		host := d.Path
+		if !isDeviceNode(host, typ[0], d.Major, d.Minor) {
+			if path, ok := hostDevicePath(typ[0], d.Major, d.Minor); ok {
+				host = path
+			} else {
+				logrus.Warnf("Device %s (%s %d:%d) does not exist on this host.", d.Path, typ, d.Major, d.Minor)
+				host = ""
+			}
+		}
+		if host != "" && !sameDeviceOwner(host, d) {
+			rc.unsupported("file mode and owner of device %s, which differ from those of %s on this host", d.Path, host)
+		}
+		if host == "" {
+			host = d.Path
+		}
+		rc.Devices = append(rc.Devices, deviceMapping{
+			PathOnHost:        host,
+			PathInContainer:   d.Path,
+			CgroupPermissions: perms,
+		})
+	}
+
+	for i, r := range rules {
+		if !r.Allow {
+			if i == 0 && isAllDevices(r) {
+				continue
+			}
+			rc.unsupported("device rule denying %s", formatDeviceRule(r))
+			continue
+		}
+		if rc.coversDeviceRule(spec.Linux.Devices, r) {
+			continue
+		}
+		rc.DeviceCgroupRules = append(rc.DeviceCgroupRules, formatDeviceRule(r))
+	}
+	return nil
+}
+
+// sameDeviceOwner reports whether the host device node at path has the
+// file mode and owner the bundle gives device d.
+func sameDeviceOwner(path string, d specs.Device) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	return (d.FileMode == nil || d.FileMode.Perm() == fi.Mode().Perm()) &&
+		(d.UID == nil || *d.UID == st.Uid) &&
+		(d.GID == nil || *d.GID == st.Gid)
+}
+
+// isAllDevices reports whether r matches every device.
+func isAllDevices(r specs.DeviceCgroup) bool {
+	return (r.Type == nil || *r.Type == "a") && r.Major == nil && r.Minor == nil
+}
+
+// deviceRuleMatches reports whether r applies to the device.
+func deviceRuleMatches(r specs.DeviceCgroup, typ string, major, minor int64) bool {
+	return (r.Type == nil || *r.Type == "a" || *r.Type == typ) &&
+		(r.Major == nil || *r.Major == major) &&
+		(r.Minor == nil || *r.Minor == minor)
+}
+
+// devicePermissions evaluates the device rules in order for a device and
+// returns the access it is left with.
+func devicePermissions(rules []specs.DeviceCgroup, typ string, major, minor int64) string {
+	granted := make(map[rune]bool)
+	for _, r := range rules {
+		if !deviceRuleMatches(r, typ, major, minor) {
+			continue
+		}
+		access := deviceAccess
+		if r.Access != nil && *r.Access != "" {
+			access = *r.Access
+		}
+		for _, c := range access {
+			granted[c] = r.Allow
+		}
+	}
+	var perms string
+	for _, c := range deviceAccess {
+		if granted[c] {
+			perms += string(c)
+		}
+	}
+	return perms
+}
+
+// coversDeviceRule reports whether an allow rule grants no more than the
+// permissions of a mapped device node already do.
+func (rc *runtimeConfig) coversDeviceRule(devices []specs.Device, r specs.DeviceCgroup) bool {
+	if r.Type == nil || r.Major == nil || r.Minor == nil {
+		return false
+	}
+	for _, d := range devices {
+		typ := d.Type
+		if typ == "u" {
+			typ = "c"
+		}
+		if typ != *r.Type || d.Major != *r.Major || d.Minor != *r.Minor {
+			continue
+		}
+		for _, m := range rc.Devices {
+			if m.PathInContainer == d.Path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatDeviceRule writes a device rule in the syntax of the devices
+// cgroup and --device-cgroup-rule: type major:minor access.
+func formatDeviceRule(r specs.DeviceCgroup) string {
+	typ, major, minor, access := "a", "*", "*", deviceAccess
+	if r.Type != nil && *r.Type != "" {
+		typ = *r.Type
+	}
+	if r.Major != nil {
+		major = fmt.Sprint(*r.Major)
+	}
+	if r.Minor != nil {
+		minor = fmt.Sprint(*r.Minor)
+	}
+	if r.Access != nil && *r.Access != "" {
+		access = strings.ToLower(*r.Access)
+	}
+	return typ + " " + major + ":" + minor + " " + access
+}
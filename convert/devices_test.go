@@ -0,0 +1,160 @@
+package convert
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// deviceRule returns a device cgroup rule; an empty typ or access and a
+// negative major or minor are left unset.
+func deviceRule(allow bool, typ string, major, minor int64, access string) specs.DeviceCgroup {
+	r := specs.DeviceCgroup{Allow: allow}
+	if typ != "" {
+		r.Type = &typ
+	}
+	if major >= 0 {
+		r.Major = &major
+	}
+	if minor >= 0 {
+		r.Minor = &minor
+	}
+	if access != "" {
+		r.Access = &access
+	}
+	return r
+}
+
+func TestMapDevices(t *testing.T) {
+	denyAll := deviceRule(false, "", -1, -1, "rwm")
+	null := specs.Device{Path: "/dev/null", Type: "c", Major: 1, Minor: 3}
+	mode := os.FileMode(0600)
+	tests := []struct {
+		name        string
+		devices     []specs.Device
+		rules       []specs.DeviceCgroup
+		allowAll    bool
+		want        []deviceMapping
+		cgroupRules []string
+		unsupported []string
+		err         string
+	}{
+		{
+			name:    "device node",
+			devices: []specs.Device{null},
+			rules:   []specs.DeviceCgroup{denyAll, deviceRule(true, "c", 1, 3, "rwm")},
+			want:    []deviceMapping{{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "rwm"}},
+		},
+		{
+			name:    "device node without rules",
+			devices: []specs.Device{{Path: "/dev/null", Type: "u", Major: 1, Minor: 3}},
+			want:    []deviceMapping{{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "rwm"}},
+		},
+		{
+			name:        "restricted access",
+			devices:     []specs.Device{null},
+			rules:       []specs.DeviceCgroup{denyAll, deviceRule(true, "c", 1, 3, "rw"), deviceRule(false, "c", 1, 3, "w")},
+			want:        []deviceMapping{{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "r"}},
+			unsupported: []string{"device rule denying c 1:3 w"},
+		},
+		{
+			name:    "renamed device",
+			devices: []specs.Device{{Path: "/dev/mynull", Type: "c", Major: 1, Minor: 3}},
+			want:    []deviceMapping{{PathOnHost: "/dev/null", PathInContainer: "/dev/mynull", CgroupPermissions: "rwm"}},
+		},
+		{
+			name:        "other mode",
+			devices:     []specs.Device{{Path: "/dev/null", Type: "c", Major: 1, Minor: 3, FileMode: &mode}},
+			want:        []deviceMapping{{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "rwm"}},
+			unsupported: []string{"file mode and owner of device /dev/null, which differ from those of /dev/null on this host"},
+		},
+		{
+			name:        "fifo",
+			devices:     []specs.Device{{Path: "/dev/fifo", Type: "p"}},
+			unsupported: []string{`device /dev/fifo of type "p"`},
+		},
+		{
+			name:        "rule without node",
+			rules:       []specs.DeviceCgroup{denyAll, deviceRule(true, "c", 10, 200, "RW"), deviceRule(true, "b", 8, -1, "")},
+			cgroupRules: []string{"c 10:200 rw", "b 8:* rwm"},
+		},
+		{
+			name:  "allow all",
+			rules: []specs.DeviceCgroup{denyAll, deviceRule(true, "a", -1, -1, "rwm")},
+			err:   "linux.resources.devices[1] allows access to all devices of the host, which needs --allow-all-devices",
+		},
+		{
+			name:  "allow all without type",
+			rules: []specs.DeviceCgroup{deviceRule(true, "", -1, -1, "")},
+			err:   "needs --allow-all-devices",
+		},
+		{
+			name:        "allow all with flag",
+			rules:       []specs.DeviceCgroup{denyAll, deviceRule(true, "a", -1, -1, "rwm")},
+			allowAll:    true,
+			cgroupRules: []string{"a *:* rwm"},
+		},
+		{
+			name:        "late deny all",
+			rules:       []specs.DeviceCgroup{deviceRule(true, "c", 10, 200, "rwm"), denyAll},
+			cgroupRules: []string{"c 10:200 rwm"},
+			unsupported: []string{"device rule denying a *:* rwm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &specs.Spec{}
+			spec.Linux.Devices = tt.devices
+			if tt.rules != nil {
+				spec.Linux.Resources = &specs.Resources{Devices: tt.rules}
+			}
+			rc := &runtimeConfig{}
+			err := rc.mapDevices(spec, tt.allowAll)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rc.Devices, tt.want) {
+				t.Errorf("got devices %+v, want %+v", rc.Devices, tt.want)
+			}
+			if !reflect.DeepEqual(rc.DeviceCgroupRules, tt.cgroupRules) {
+				t.Errorf("got rules %q, want %q", rc.DeviceCgroupRules, tt.cgroupRules)
+			}
+			if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+				t.Errorf("got unsupported %q, want %q", rc.Unsupported, tt.unsupported)
+			}
+		})
+	}
+}
+
+func TestDevicePermissions(t *testing.T) {
+	tests := []struct {
+		rules []specs.DeviceCgroup
+		want  string
+	}{
+		{nil, ""},
+		{[]specs.DeviceCgroup{deviceRule(true, "a", -1, -1, "")}, "rwm"},
+		{[]specs.DeviceCgroup{deviceRule(true, "b", 1, 3, "rwm")}, ""},
+		{[]specs.DeviceCgroup{deviceRule(true, "c", 1, -1, "mr")}, "rm"},
+		{[]specs.DeviceCgroup{deviceRule(true, "c", 1, 3, "rwm"), deviceRule(false, "c", 1, 3, "m")}, "rw"},
+		{[]specs.DeviceCgroup{deviceRule(false, "c", 1, 3, "rwm"), deviceRule(true, "c", -1, 3, "w")}, "w"},
+		{[]specs.DeviceCgroup{deviceRule(true, "c", 1, 4, "rwm")}, ""},
+	}
+	for _, tt := range tests {
+		if got := devicePermissions(tt.rules, "c", 1, 3); got != tt.want {
+			var rules []string
+			for _, r := range tt.rules {
+				rules = append(rules, formatDeviceRule(r))
+			}
+			t.Errorf("devicePermissions(%q) = %q, want %q", rules, got, tt.want)
+		}
+	}
+}
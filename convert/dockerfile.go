@@ -0,0 +1,58 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helpers available to Dockerfile templates.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, for the exec form of CMD and
+	// ENTRYPOINT or any quoted string.
+	"json": templateJSON,
+	// kv formats a name and value as name="value" for LABEL and ENV.
+	"kv": func(name, value string) string {
+		return name + "=" + templateJSON(value)
+	},
+	// env quotes the value of a NAME=value environment entry.
+	"env": func(kv string) string {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return kv + `=""`
+		}
+		return kv[:i] + "=" + templateJSON(kv[i+1:])
+	},
+	"join": strings.Join,
+}
+
+func templateJSON(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// loadTemplate parses the Dockerfile template in file, or the built-in
+// template when file is empty.
+func loadTemplate(file string) (*template.Template, error) {
+	text := buildTemplate
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading Dockerfile template: %v", err)
+		}
+		text = string(data)
+	}
+	t, err := template.New("Dockerfile").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Dockerfile template: %v", err)
+	}
+	return t, nil
+}
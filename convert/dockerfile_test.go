@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci2docker-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, text string) string {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	info := DockerInfo{
+		Appdir: "./rootfs",
+		Add:    true,
+		Config: containerConfig{
+			User:       "1000:1000",
+			Env:        []string{"PATH=/usr/bin:/bin", `GREETING=say "hi" <there>`, "EMPTY"},
+			Entrypoint: []string{"/bin/app"},
+			Cmd:        []string{"--port", "80"},
+			WorkingDir: "/srv",
+			Labels:     map[string]string{"maintainer": "cts", "version": "1.0"},
+		},
+		Platform: platform{Architecture: "arm64", OS: "linux"},
+		Port:     true,
+		Expose:   "80/tcp 53/udp",
+	}
+	tests := []struct {
+		name string
+		file string
+		info DockerInfo
+		want string
+		err  string
+	}{
+		{
+			name: "built-in",
+			info: info,
+			want: `FROM scratch
+LABEL maintainer="cts"
+LABEL version="1.0"
+ADD ./rootfs .
+ENV PATH="/usr/bin:/bin"
+ENV GREETING="say \"hi\" <there>"
+ENV EMPTY=""
+USER 1000:1000
+WORKDIR /srv
+CMD ["--port","80"]
+ENTRYPOINT ["/bin/app"]
+EXPOSE 80/tcp 53/udp
+`,
+		},
+		{
+			name: "built-in minimal",
+			info: DockerInfo{},
+			want: "FROM scratch\n",
+		},
+		{
+			name: "custom",
+			file: write("custom", "FROM {{.Platform.OS}}/{{.Platform.Architecture}}/base\nRUN {{join .Config.Cmd \" \"}}\n"),
+			info: info,
+			want: "FROM linux/arm64/base\nRUN --port 80\n",
+		},
+		{
+			name: "missing file",
+			file: filepath.Join(dir, "missing"),
+			err:  "reading Dockerfile template:",
+		},
+		{
+			name: "syntax error",
+			file: write("broken", "FROM {{.Platform"),
+			err:  "parsing Dockerfile template:",
+		},
+		{
+			name: "unknown field",
+			file: write("unknown", "FROM {{.Image}}\n"),
+			info: info,
+			err:  "can't evaluate field Image",
+		},
+	}
+	for _, tt := range tests {
+		tmpl, err := loadTemplate(tt.file)
+		if err == nil {
+			var buf bytes.Buffer
+			err = tmpl.Execute(&buf, tt.info)
+			if err == nil && buf.String() != tt.want {
+				t.Errorf("%s: got\n%s\nwant\n%s", tt.name, buf.String(), tt.want)
+			}
+		}
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package convert
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// archSampleSize is how many executables besides the entrypoint are checked
+// against the bundle platform.
+const archSampleSize = 64
+
+// elfTarget is the machine, word size and byte order binaries must be built
+// for to run on an architecture.
+type elfTarget struct {
+	machine elf.Machine
+	class   elf.Class
+	order   elf.Data
+}
+
+// elfTargets maps platform.arch values, which follow GOARCH, to ELF
+// headers.
+var elfTargets = map[string]elfTarget{
+	"386":      {elf.EM_386, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"amd64":    {elf.EM_X86_64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"arm":      {elf.EM_ARM, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"arm64":    {elf.EM_AARCH64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"ppc64":    {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"ppc64le":  {elf.EM_PPC64, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"s390x":    {elf.EM_S390, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"mips":     {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2MSB},
+	"mipsle":   {elf.EM_MIPS, elf.ELFCLASS32, elf.ELFDATA2LSB},
+	"mips64":   {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2MSB},
+	"mips64le": {elf.EM_MIPS, elf.ELFCLASS64, elf.ELFDATA2LSB},
+	"riscv64":  {elf.EM_RISCV, elf.ELFCLASS64, elf.ELFDATA2LSB},
+}
+
+func (t elfTarget) String() string {
+	bits := "32-bit"
+	if t.class == elf.ELFCLASS64 {
+		bits = "64-bit"
+	}
+	order := "LSB"
+	if t.order == elf.ELFDATA2MSB {
+		order = "MSB"
+	}
+	return fmt.Sprintf("%s %s %s", bits, order, strings.TrimPrefix(t.machine.String(), "EM_"))
+}
+
+// elfHeader is the part of an ELF file header needed to tell what a binary
+// runs on.
+type elfHeader struct {
+	elfTarget
+	byteOrder binary.ByteOrder
+}
+
+// parseELFHeader decodes the ELF header at the start of head. ok is false
+// when head is not an ELF file.
+func parseELFHeader(head []byte) (h elfHeader, ok bool) {
+	if len(head) < 20 || !bytes.HasPrefix(head, []byte(elf.ELFMAG)) {
+		return h, false
+	}
+	h.class = elf.Class(head[elf.EI_CLASS])
+	h.order = elf.Data(head[elf.EI_DATA])
+	switch h.order {
+	case elf.ELFDATA2LSB:
+		h.byteOrder = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		h.byteOrder = binary.BigEndian
+	default:
+		return h, false
+	}
+	h.machine = elf.Machine(h.byteOrder.Uint16(head[18:20]))
+	return h, true
+}
+
+// elfInterpreter returns the program interpreter (PT_INTERP) of the ELF
+// executable whose first bytes are head. interp is empty for static
+// binaries; ok is false when head is not an ELF executable, or when the
+// program headers lie beyond head.
+func elfInterpreter(head []byte) (interp string, ok bool) {
+	h, ok := parseELFHeader(head)
+	if !ok {
+		return "", false
+	}
+	bo := h.byteOrder
+	var phoff, phentsize, phnum uint64
+	switch h.class {
+	case elf.ELFCLASS64:
+		if len(head) < 64 {
+			return "", false
+		}
+		phoff = bo.Uint64(head[32:40])
+		phentsize, phnum = uint64(bo.Uint16(head[54:56])), uint64(bo.Uint16(head[56:58]))
+	case elf.ELFCLASS32:
+		if len(head) < 52 {
+			return "", false
+		}
+		phoff = uint64(bo.Uint32(head[28:32]))
+		phentsize, phnum = uint64(bo.Uint16(head[42:44])), uint64(bo.Uint16(head[44:46]))
+	default:
+		return "", false
+	}
+	switch elf.Type(bo.Uint16(head[16:18])) {
+	case elf.ET_EXEC, elf.ET_DYN:
+	default:
+		return "", false
+	}
+	if phoff > uint64(len(head)) {
+		return "", false
+	}
+	for i := uint64(0); i < phnum; i++ {
+		ph := phoff + i*phentsize
+		if ph+phentsize > uint64(len(head)) || phentsize < 32 {
+			return "", false
+		}
+		if elf.ProgType(bo.Uint32(head[ph:ph+4])) != elf.PT_INTERP {
+			continue
+		}
+		var off, size uint64
+		if h.class == elf.ELFCLASS64 {
+			off, size = bo.Uint64(head[ph+8:ph+16]), bo.Uint64(head[ph+32:ph+40])
+		} else {
+			off, size = uint64(bo.Uint32(head[ph+4:ph+8])), uint64(bo.Uint32(head[ph+16:ph+20]))
+		}
+		if off > uint64(len(head)) || size > uint64(len(head))-off {
+			return "", false
+		}
+		return strings.TrimRight(string(head[off:off+size]), "\x00"), true
+	}
+	return "", true
+}
+
+// checkArchitecture compares the ELF headers of the resolved entrypoint and
+// of a sample of the executables in the rootfs with spec.Platform.Arch. Bundles
+// that do not declare an architecture, or declare one we know nothing
+// about, are not checked.
+func checkArchitecture(spec *specs.Spec, idx *rootfsIndex, entrypoint string) error {
+	arch := spec.Platform.Arch
+	want, ok := elfTargets[arch]
+	if !ok {
+		if arch != "" {
+			logrus.Debugf("No ELF machine known for architecture %s, skipping the check.", arch)
+		}
+		return nil
+	}
+
+	names := []string{strings.TrimPrefix(entrypoint, "/")}
+	sampled := 0
+	for _, name := range idx.executables() {
+		if sampled == archSampleSize {
+			break
+		}
+		if _, ok := parseELFHeader(idx.entries[name].head); ok {
+			names = append(names, name)
+			sampled++
+		}
+	}
+
+	var mismatches []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		h, ok := parseELFHeader(idx.entries[name].head)
+		if !ok || h.elfTarget == want {
+			continue
+		}
+		mismatches = append(mismatches, fmt.Sprintf("/%s is %s", name, h.elfTarget))
+	}
+	logrus.Debugf("Checked %d executables against %s.", len(seen), arch)
+	if len(mismatches) > 5 {
+		mismatches = append(mismatches[:5], fmt.Sprintf("and %d more", len(mismatches)-5))
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("platform.arch is %s (%s) but the rootfs does not match: %s",
+			arch, want, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package convert
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// elfHead returns the start of an ELF file of type typ for target, with a
+// PT_INTERP program header naming interp if it is not empty.
+func elfHead(target elfTarget, typ elf.Type, interp string) string {
+	var bo binary.ByteOrder = binary.LittleEndian
+	if target.order == elf.ELFDATA2MSB {
+		bo = binary.BigEndian
+	}
+	ehsize, phentsize := 52, 32
+	if target.class == elf.ELFCLASS64 {
+		ehsize, phentsize = 64, 56
+	}
+	head := make([]byte, ehsize+phentsize+len(interp)+1)
+	copy(head, elf.ELFMAG)
+	head[elf.EI_CLASS], head[elf.EI_DATA], head[elf.EI_VERSION] = byte(target.class), byte(target.order), 1
+	bo.PutUint16(head[16:], uint16(typ))
+	bo.PutUint16(head[18:], uint16(target.machine))
+	phnum := 0
+	if interp != "" {
+		phnum = 1
+	}
+	ph, off, size := head[ehsize:], ehsize+phentsize, len(interp)+1
+	bo.PutUint32(ph, uint32(elf.PT_INTERP))
+	if target.class == elf.ELFCLASS64 {
+		bo.PutUint64(head[32:], uint64(ehsize))
+		bo.PutUint16(head[54:], uint16(phentsize))
+		bo.PutUint16(head[56:], uint16(phnum))
+		bo.PutUint64(ph[8:], uint64(off))
+		bo.PutUint64(ph[32:], uint64(size))
+	} else {
+		bo.PutUint32(head[28:], uint32(ehsize))
+		bo.PutUint16(head[42:], uint16(phentsize))
+		bo.PutUint16(head[44:], uint16(phnum))
+		bo.PutUint32(ph[4:], uint32(off))
+		bo.PutUint32(ph[16:], uint32(size))
+	}
+	copy(head[off:], interp)
+	return string(head)
+}
+
+func TestElfInterpreter(t *testing.T) {
+	amd64, arm, s390x := elfTargets["amd64"], elfTargets["arm"], elfTargets["s390x"]
+	dynamic := elfHead(amd64, elf.ET_DYN, "/lib64/ld-linux-x86-64.so.2")
+	tests := []struct {
+		name   string
+		head   string
+		target elfTarget
+		interp string
+		ok     bool
+	}{
+		{name: "static", head: elfHead(amd64, elf.ET_EXEC, ""), target: amd64, ok: true},
+		{name: "dynamic", head: dynamic, target: amd64, interp: "/lib64/ld-linux-x86-64.so.2", ok: true},
+		{name: "32-bit", head: elfHead(arm, elf.ET_EXEC, "/lib/ld-linux.so.3"), target: arm, interp: "/lib/ld-linux.so.3", ok: true},
+		{name: "big endian", head: elfHead(s390x, elf.ET_DYN, "/lib/ld64.so.1"), target: s390x, interp: "/lib/ld64.so.1", ok: true},
+		{name: "relocatable", head: elfHead(amd64, elf.ET_REL, ""), target: amd64},
+		{name: "truncated program headers", head: dynamic[:100], target: amd64},
+		{name: "truncated header", head: dynamic[:40], target: amd64},
+	}
+	for _, tt := range tests {
+		h, ok := parseELFHeader([]byte(tt.head))
+		if !ok || h.elfTarget != tt.target {
+			t.Errorf("%s: parseELFHeader = %v, %v, want %v", tt.name, h.elfTarget, ok, tt.target)
+		}
+		interp, ok := elfInterpreter([]byte(tt.head))
+		if interp != tt.interp || ok != tt.ok {
+			t.Errorf("%s: elfInterpreter = %q, %v, want %q, %v", tt.name, interp, ok, tt.interp, tt.ok)
+		}
+	}
+
+	for _, head := range []string{"", "#!/bin/sh\n", "\x7fELF", "\x7fELF\x02\x03" + strings.Repeat("\x00", 20)} {
+		if _, ok := parseELFHeader([]byte(head)); ok {
+			t.Errorf("parseELFHeader(%q) accepted a non-ELF file", head)
+		}
+	}
+}
+
+func TestCheckArchitecture(t *testing.T) {
+	amd64 := elfHead(elfTargets["amd64"], elf.ET_EXEC, "")
+	arm64 := elfHead(elfTargets["arm64"], elf.ET_EXEC, "")
+	tests := []struct {
+		name    string
+		arch    string
+		entries []testEntry
+		err     string
+	}{
+		{
+			name:    "matching",
+			arch:    "amd64",
+			entries: []testEntry{{name: "bin/app", content: amd64}, {name: "bin/run.sh", content: "#!/bin/sh\n"}},
+		},
+		{
+			name:    "no architecture",
+			entries: []testEntry{{name: "bin/app", content: arm64}},
+		},
+		{
+			name:    "unknown architecture",
+			arch:    "sparc64",
+			entries: []testEntry{{name: "bin/app", content: arm64}},
+		},
+		{
+			name:    "entrypoint mismatch",
+			arch:    "amd64",
+			entries: []testEntry{{name: "bin/app", content: arm64}},
+			err:     "platform.arch is amd64 (64-bit LSB X86_64) but the rootfs does not match: /bin/app is 64-bit LSB AARCH64",
+		},
+		{
+			name:    "other executable mismatch",
+			arch:    "arm",
+			entries: []testEntry{{name: "bin/app", content: elfHead(elfTargets["arm"], elf.ET_EXEC, "")}, {name: "usr/bin/tool", content: amd64}},
+			err:     "/usr/bin/tool is 64-bit LSB X86_64",
+		},
+		{
+			name: "many mismatches",
+			arch: "arm64",
+			entries: []testEntry{
+				{name: "bin/app", content: amd64}, {name: "bin/a", content: amd64}, {name: "bin/b", content: amd64},
+				{name: "bin/c", content: amd64}, {name: "bin/d", content: amd64}, {name: "bin/e", content: amd64},
+				{name: "bin/f", content: amd64, mode: 0644},
+			},
+			err: "and 1 more",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &specs.Spec{}
+			spec.Platform.Arch = tt.arch
+			err := checkArchitecture(spec, newTestIndex(tt.entries...), "/bin/app")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestElfTargetString(t *testing.T) {
+	for arch, want := range map[string]string{
+		"386":     "32-bit LSB 386",
+		"ppc64":   "64-bit MSB PPC64",
+		"riscv64": "64-bit LSB RISCV",
+	} {
+		if got := fmt.Sprint(elfTargets[arch]); got != want {
+			t.Errorf("elfTargets[%q] = %q, want %q", arch, got, want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultDockerHost is where the Docker daemon listens when DOCKER_HOST is
+// not set.
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// engineClient talks to the Docker Engine API of the local daemon.
+type engineClient struct {
+	network string
+	address string
+	client  *http.Client
+}
+
+// createRequest is the body of a container create request.
+type createRequest struct {
+	Image        string     `json:"Image"`
+	Hostname     string     `json:"Hostname,omitempty"`
+	User         string     `json:"User,omitempty"`
+	Env          []string   `json:"Env,omitempty"`
+	Entrypoint   []string   `json:"Entrypoint,omitempty"`
+	Cmd          []string   `json:"Cmd"`
+	WorkingDir   string     `json:"WorkingDir,omitempty"`
+	Tty          bool       `json:"Tty"`
+	OpenStdin    bool       `json:"OpenStdin"`
+	StdinOnce    bool       `json:"StdinOnce"`
+	AttachStdin  bool       `json:"AttachStdin"`
+	AttachStdout bool       `json:"AttachStdout"`
+	AttachStderr bool       `json:"AttachStderr"`
+	HostConfig   hostConfig `json:"HostConfig"`
+}
+
+// newEngineClient connects to the daemon named by DOCKER_HOST, a unix
+// socket or a plain TCP address.
+func newEngineClient() (*engineClient, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+		return nil, fmt.Errorf("TLS connections to the Docker daemon are not supported")
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: %v", host, err)
+	}
+	c := &engineClient{}
+	switch u.Scheme {
+	case "unix":
+		c.network, c.address = "unix", u.Path
+	case "tcp":
+		c.network, c.address = "tcp", u.Host
+	default:
+		return nil, fmt.Errorf("invalid DOCKER_HOST %q: expected unix:// or tcp://", host)
+	}
+	c.client = &http.Client{
+		Transport: &http.Transport{Dial: func(string, string) (net.Conn, error) {
+			return c.dial()
+		}},
+	}
+	return c, nil
+}
+
+func (c *engineClient) dial() (net.Conn, error) {
+	return net.Dial(c.network, c.address)
+}
+
+// do sends a request with body encoded as JSON and decodes the response
+// into v, when given.
+func (c *engineClient) do(method, path string, body interface{}, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://docker"+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return engineError(resp)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// engineError reads the message of an Engine API error response.
+func engineError(resp *http.Response) error {
+	var e struct {
+		Message string `json:"message"`
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &e) == nil && e.Message != "" {
+		return fmt.Errorf("%s", e.Message)
+	}
+	return fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(data)))
+}
+
+// createContainer creates a container named name, or an unnamed one when
+// name is empty, and returns its ID.
+func (c *engineClient) createContainer(name string, req createRequest) (string, []string, error) {
+	path := "/containers/create"
+	if name != "" {
+		path += "?name=" + url.QueryEscape(name)
+	}
+	var resp struct {
+		ID       string   `json:"Id"`
+		Warnings []string `json:"Warnings"`
+	}
+	if err := c.do("POST", path, req, &resp); err != nil {
+		return "", nil, err
+	}
+	return resp.ID, resp.Warnings, nil
+}
+
+func (c *engineClient) startContainer(id string) error {
+	return c.do("POST", "/containers/"+id+"/start", nil, nil)
+}
+
+// waitContainer waits for a container to exit and returns its status.
+func (c *engineClient) waitContainer(id string) (int, error) {
+	var resp struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	err := c.do("POST", "/containers/"+id+"/wait", nil, &resp)
+	return resp.StatusCode, err
+}
+
+// attachContainer attaches to the standard streams of a container. The
+// returned connection carries stdin to the container; its output is read
+// from the returned reader, multiplexed unless the container has a tty.
+func (c *engineClient) attachContainer(id string) (net.Conn, *bufio.Reader, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest("POST", "http://docker/containers/"+id+"/attach?stream=1&stdin=1&stdout=1&stderr=1", nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, nil, engineError(resp)
+	}
+	return conn, br, nil
+}
+
+// demuxStreams copies the multiplexed output of a container without a tty
+// to stdout and stderr. Each frame has an 8 byte header: the stream, three
+// zero bytes and the big-endian size of the payload.
+func demuxStreams(r io.Reader, stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setEnv sets an environment variable and returns a function restoring it.
+func setEnv(key, value string) func() {
+	old, set := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if set {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// frame returns a frame of the multiplexed output of a container.
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestNewEngineClient(t *testing.T) {
+	tests := []struct {
+		host    string
+		tls     string
+		network string
+		address string
+		err     string
+	}{
+		{host: "", network: "unix", address: "/var/run/docker.sock"},
+		{host: "unix:///run/user/1000/docker.sock", network: "unix", address: "/run/user/1000/docker.sock"},
+		{host: "tcp://127.0.0.1:2375", network: "tcp", address: "127.0.0.1:2375"},
+		{host: "tcp://127.0.0.1:2376", tls: "1", err: "TLS connections to the Docker daemon are not supported"},
+		{host: "ssh://docker@host", err: `invalid DOCKER_HOST "ssh://docker@host": expected unix:// or tcp://`},
+		{host: "tcp://[::1", err: `invalid DOCKER_HOST "tcp://[::1"`},
+	}
+	for _, tt := range tests {
+		restoreHost := setEnv("DOCKER_HOST", tt.host)
+		restoreTLS := setEnv("DOCKER_TLS_VERIFY", tt.tls)
+		c, err := newEngineClient()
+		restoreHost()
+		restoreTLS()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("DOCKER_HOST=%q: got error %v, want %q", tt.host, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || c.network != tt.network || c.address != tt.address {
+			t.Errorf("DOCKER_HOST=%q: got %v, %v, want %s %s", tt.host, c, err, tt.network, tt.address)
+		}
+	}
+}
+
+func TestEngineClient(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		created  createRequest
+		requests []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/containers/create":
+			if r.Header.Get("Content-Type") != "application/json" {
+				http.Error(w, "bad content type", http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("name") == "taken" {
+				w.WriteHeader(http.StatusConflict)
+				io.WriteString(w, `{"message":"Conflict. The container name \"/taken\" is already in use"}`)
+				return
+			}
+			mu.Lock()
+			json.NewDecoder(r.Body).Decode(&created)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"Id":"c0ffee","Warnings":["swap limit not supported"]}`)
+		case "/containers/c0ffee/start":
+			w.WriteHeader(http.StatusNoContent)
+		case "/containers/c0ffee/wait":
+			io.WriteString(w, `{"StatusCode":3}`)
+		case "/containers/c0ffee/attach":
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+			rw.Flush()
+			input := make([]byte, 4)
+			if _, err := io.ReadFull(rw, input); err != nil {
+				return
+			}
+			conn.Write(frame(1, "got "+string(input)+"\n"))
+			conn.Write(frame(2, "warning\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "page not found\n")
+		}
+	}))
+	defer server.Close()
+	defer setEnv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))()
+
+	c, err := newEngineClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := createRequest{Image: "cts/app:1.0", Entrypoint: []string{"/bin/app"}, Cmd: []string{}}
+	id, warnings, err := c.createContainer("my app", req)
+	if err != nil || id != "c0ffee" || !reflect.DeepEqual(warnings, []string{"swap limit not supported"}) {
+		t.Fatalf("createContainer = %q, %q, %v", id, warnings, err)
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(created, req) {
+		t.Errorf("the daemon got %+v, want %+v", created, req)
+	}
+	mu.Unlock()
+	if _, _, err := c.createContainer("taken", req); err == nil || err.Error() != `Conflict. The container name "/taken" is already in use` {
+		t.Errorf("got error %v for a taken name", err)
+	}
+	if err := c.startContainer("c0ffee"); err != nil {
+		t.Errorf("startContainer: %v", err)
+	}
+	if err := c.startContainer("missing"); err == nil || err.Error() != "404 Not Found page not found" {
+		t.Errorf("got error %v for a missing container", err)
+	}
+	if status, err := c.waitContainer("c0ffee"); err != nil || status != 3 {
+		t.Errorf("waitContainer = %d, %v, want 3", status, err)
+	}
+
+	conn, output, err := c.attachContainer("c0ffee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "ping")
+	var stdout, stderr bytes.Buffer
+	if err := demuxStreams(output, &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "got ping\n" || stderr.String() != "warning\n" {
+		t.Errorf("got stdout %q and stderr %q", stdout.String(), stderr.String())
+	}
+	if _, _, err := c.attachContainer("missing"); err == nil {
+		t.Errorf("attached to a missing container")
+	}
+
+	want := []string{
+		"POST /containers/create?name=my+app",
+		"POST /containers/create?name=taken",
+		"POST /containers/c0ffee/start",
+		"POST /containers/missing/start",
+		"POST /containers/c0ffee/wait",
+		"POST /containers/c0ffee/attach?stream=1&stdin=1&stdout=1&stderr=1",
+		"POST /containers/missing/attach?stream=1&stdin=1&stdout=1&stderr=1",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("got requests %q, want %q", requests, want)
+	}
+}
+
+func TestDemuxStreams(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          []byte
+		stdout, stderr string
+		err            bool
+	}{
+		{name: "empty"},
+		{
+			name:   "interleaved",
+			input:  bytes.Join([][]byte{frame(1, "out 1\n"), frame(2, "err\n"), frame(1, ""), frame(1, "out 2\n")}, nil),
+			stdout: "out 1\nout 2\n",
+			stderr: "err\n",
+		},
+		{name: "truncated header", input: frame(1, "out")[:5], err: true},
+		{name: "truncated payload", input: frame(1, "out")[:10], stdout: "ou", err: true},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		err := demuxStreams(bytes.NewReader(tt.input), &stdout, &stderr)
+		if (err != nil) != tt.err || stdout.String() != tt.stdout || stderr.String() != tt.stderr {
+			t.Errorf("%s: got %q, %q, %v", tt.name, stdout.String(), stderr.String(), err)
+		}
+	}
+	if err := demuxStreams(bytes.NewReader(frame(2, "x")), ioutil.Discard, &failingWriter{}); err == nil {
+		t.Errorf("demuxStreams ignored a write error")
+	}
+}
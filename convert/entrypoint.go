@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// defaultPath is the PATH used to resolve the entrypoint when the bundle
+// does not set one, the same default Docker uses.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// maxInterpreterDepth is how many levels of #! interpreters the kernel
+// follows before giving up.
+const maxInterpreterDepth = 4
+
+// checkEntrypoint resolves the program the container starts in the rootfs,
+// using the PATH of the bundle, and checks that it can actually be run. An
+// empty process.args falls back to /bin/sh, which must then exist. The
+// resolved path is returned.
+func checkEntrypoint(spec *specs.Spec, idx *rootfsIndex) (string, error) {
+	name := "/bin/sh"
+	if len(spec.Process.Args) > 0 {
+		name = spec.Process.Args[0]
+	}
+	pathEnv, ok := envValue(spec.Process.Env, "PATH")
+	if !ok {
+		pathEnv = defaultPath
+	}
+	p, e, err := idx.lookPath(name, pathEnv, spec.Process.Cwd)
+	if err != nil {
+		if len(spec.Process.Args) == 0 {
+			return "", fmt.Errorf("process.args is empty and the rootfs has no /bin/sh to fall back to: %v", err)
+		}
+		return "", fmt.Errorf("entrypoint %s: %v", name, err)
+	}
+	if err := checkProgram(idx, p, e, spec.Process.User, 0); err != nil {
+		return "", fmt.Errorf("entrypoint %s: %v", name, err)
+	}
+	logrus.Debugf("Entrypoint %s resolves to %s.", name, p)
+	return p, nil
+}
+
+// checkProgram checks that the file at p can be executed by user: it must
+// be a regular file with an execute bit for user, and the ELF interpreter
+// or #! interpreter it names must exist in the rootfs.
+func checkProgram(idx *rootfsIndex, p string, e *rootfsEntry, user specs.User, depth int) error {
+	switch e.hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeLink:
+	default:
+		return fmt.Errorf("%s is not a regular file", p)
+	}
+	if !canExecute(e.hdr, user) {
+		return fmt.Errorf("%s (mode %04o, owner %d:%d) is not executable by user %d:%d",
+			p, e.hdr.Mode&07777, e.hdr.Uid, e.hdr.Gid, user.UID, user.GID)
+	}
+
+	if interp, ok := elfInterpreter(e.head); ok {
+		if interp == "" {
+			return nil
+		}
+		ip, ie, err := idx.resolve(interp)
+		if err == nil && ie.isDir() {
+			err = fmt.Errorf("%s is a directory", ip)
+		}
+		if err != nil {
+			return fmt.Errorf("ELF interpreter %s of %s: %v", interp, p, err)
+		}
+		return nil
+	}
+	if _, ok := parseELFHeader(e.head); ok {
+		// An ELF file whose program headers we could not read.
+		return nil
+	}
+	if !bytes.HasPrefix(e.head, []byte("#!")) {
+		return fmt.Errorf("%s is neither an ELF binary nor a #! script", p)
+	}
+	if depth == maxInterpreterDepth {
+		return fmt.Errorf("%s: too many levels of #! interpreters", p)
+	}
+	interp := parseShebang(e.head)
+	if interp == "" {
+		return fmt.Errorf("%s has an empty #! line", p)
+	}
+	ip, ie, err := idx.resolve(interp)
+	if err != nil {
+		return fmt.Errorf("interpreter %s of %s: %v", interp, p, err)
+	}
+	return checkProgram(idx, ip, ie, user, depth+1)
+}
+
+// parseShebang returns the interpreter named on the #! line at the start
+// of head.
+func parseShebang(head []byte) string {
+	line := head[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// canExecute applies the permission bits of hdr the way the kernel does
+// for user. Root may execute any file with at least one execute bit.
+func canExecute(hdr *tar.Header, user specs.User) bool {
+	mode := hdr.Mode
+	if user.UID == 0 {
+		return mode&0111 != 0
+	}
+	if int(user.UID) == hdr.Uid {
+		return mode&0100 != 0
+	}
+	inGroup := int(user.GID) == hdr.Gid
+	for _, gid := range user.AdditionalGids {
+		inGroup = inGroup || int(gid) == hdr.Gid
+	}
+	if inGroup {
+		return mode&0010 != 0
+	}
+	return mode&0001 != 0
+}
@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"archive/tar"
+	"debug/elf"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestCheckEntrypoint(t *testing.T) {
+	static := elfHead(elfTargets["amd64"], elf.ET_EXEC, "")
+	dynamic := elfHead(elfTargets["amd64"], elf.ET_DYN, "/lib64/ld.so")
+	// base is the rootfs of every case, the shell first.
+	base := []testEntry{
+		{name: "bin/sh", content: static},
+		{name: "usr/bin/app", content: dynamic},
+		{name: "lib64/ld.so", content: static},
+		{name: "opt/"},
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		env     []string
+		cwd     string
+		user    specs.User
+		entries []testEntry
+		noShell bool
+		want    string
+		err     string
+	}{
+		{name: "default shell", want: "/bin/sh"},
+		{name: "path lookup", args: []string{"app", "--flag"}, want: "/usr/bin/app"},
+		{name: "bundle path", args: []string{"tool"}, env: []string{"PATH=/opt/bin"}, entries: []testEntry{{name: "opt/bin/tool", content: static}}, want: "/opt/bin/tool"},
+		{name: "relative to cwd", args: []string{"./run"}, cwd: "/opt", entries: []testEntry{{name: "opt/run", content: static}}, want: "/opt/run"},
+		{name: "script", args: []string{"/opt/run.sh"}, entries: []testEntry{{name: "opt/run.sh", content: "#!/bin/sh -e\necho hi\n"}}, want: "/opt/run.sh"},
+		{
+			name:    "group execute",
+			args:    []string{"/opt/run"},
+			user:    specs.User{UID: 1000, GID: 1000, AdditionalGids: []uint32{50}},
+			entries: []testEntry{{name: "opt/run", content: static, mode: 0750, gid: 50}},
+			want:    "/opt/run",
+		},
+		{
+			name:    "no shell",
+			noShell: true,
+			err:     "process.args is empty and the rootfs has no /bin/sh to fall back to",
+		},
+		{name: "not found", args: []string{"bash"}, err: `entrypoint bash: bash not found in PATH "` + defaultPath + `"`},
+		{name: "directory", args: []string{"/opt"}, err: "entrypoint /opt: /opt is not a regular file"},
+		{
+			name:    "not executable",
+			args:    []string{"/opt/run"},
+			entries: []testEntry{{name: "opt/run", content: static, mode: 0644}},
+			err:     "/opt/run (mode 0644, owner 0:0) is not executable by user 0:0",
+		},
+		{
+			name:    "owner only",
+			args:    []string{"/opt/run"},
+			user:    specs.User{UID: 1000, GID: 1000},
+			entries: []testEntry{{name: "opt/run", content: static, mode: 0700}},
+			err:     "is not executable by user 1000:1000",
+		},
+		{
+			name:    "missing ELF interpreter",
+			args:    []string{"/opt/run"},
+			entries: []testEntry{{name: "opt/run", content: elfHead(elfTargets["amd64"], elf.ET_EXEC, "/lib/ld-musl.so")}},
+			err:     "ELF interpreter /lib/ld-musl.so of /opt/run: /lib does not exist in the rootfs",
+		},
+		{
+			name:    "ELF interpreter directory",
+			args:    []string{"/opt/run"},
+			entries: []testEntry{{name: "opt/run", content: elfHead(elfTargets["amd64"], elf.ET_EXEC, "/opt")}},
+			err:     "ELF interpreter /opt of /opt/run: /opt is a directory",
+		},
+		{
+			name:    "missing script interpreter",
+			args:    []string{"/opt/run.py"},
+			entries: []testEntry{{name: "opt/run.py", content: "#!/usr/bin/python3\n"}},
+			err:     "interpreter /usr/bin/python3 of /opt/run.py: /usr/bin/python3 does not exist in the rootfs",
+		},
+		{
+			name:    "script loop",
+			args:    []string{"/opt/run.sh"},
+			entries: []testEntry{{name: "opt/run.sh", content: "#!/opt/run.sh\n"}},
+			err:     "too many levels of #! interpreters",
+		},
+		{
+			name:    "empty shebang",
+			args:    []string{"/opt/run.sh"},
+			entries: []testEntry{{name: "opt/run.sh", content: "#!  \n"}},
+			err:     "/opt/run.sh has an empty #! line",
+		},
+		{
+			name:    "text file",
+			args:    []string{"/opt/README"},
+			entries: []testEntry{{name: "opt/README", content: "hello"}},
+			err:     "/opt/README is neither an ELF binary nor a #! script",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := append(append([]testEntry{}, base...), tt.entries...)
+			if tt.noShell {
+				entries = entries[1:]
+			}
+			spec := &specs.Spec{}
+			spec.Process.Args = tt.args
+			spec.Process.Env = tt.env
+			spec.Process.Cwd = tt.cwd
+			spec.Process.User = tt.user
+			got, err := checkEntrypoint(spec, newTestIndex(entries...))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanExecute(t *testing.T) {
+	root := specs.User{}
+	user := specs.User{UID: 1000, GID: 100, AdditionalGids: []uint32{10}}
+	tests := []struct {
+		mode     int64
+		uid, gid int
+		user     specs.User
+		want     bool
+	}{
+		{0755, 0, 0, root, true},
+		{0001, 5, 5, root, true},
+		{0644, 0, 0, root, false},
+		{0700, 1000, 0, user, true},
+		{0070, 1000, 100, user, false},
+		{0010, 0, 100, user, true},
+		{0010, 0, 10, user, true},
+		{0001, 0, 10, user, false},
+		{0001, 0, 0, user, true},
+		{0770, 0, 0, user, false},
+	}
+	for _, tt := range tests {
+		hdr := &tar.Header{Mode: tt.mode, Uid: tt.uid, Gid: tt.gid}
+		if got := canExecute(hdr, tt.user); got != tt.want {
+			t.Errorf("canExecute(mode %04o, owner %d:%d, user %d:%d) = %v, want %v", tt.mode, tt.uid, tt.gid, tt.user.UID, tt.user.GID, got, tt.want)
+		}
+	}
+}
+
+func TestParseShebang(t *testing.T) {
+	tests := []struct {
+		head string
+		want string
+	}{
+		{"#!/bin/sh\n", "/bin/sh"},
+		{"#! /usr/bin/env python3\nprint()", "/usr/bin/env"},
+		{"#!/bin/bash", "/bin/bash"},
+		{"#!\n/bin/sh", ""},
+		{"#!", ""},
+	}
+	for _, tt := range tests {
+		if got := parseShebang([]byte(tt.head)); got != tt.want {
+			t.Errorf("parseShebang(%q) = %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hostConfig is the HostConfig of a Docker Engine API container create
+// request.
+type hostConfig struct {
+	NetworkMode  string `json:"NetworkMode,omitempty"`
+	PidMode      string `json:"PidMode,omitempty"`
+	IpcMode      string `json:"IpcMode,omitempty"`
+	UTSMode      string `json:"UTSMode,omitempty"`
+	UsernsMode   string `json:"UsernsMode,omitempty"`
+	CgroupnsMode string `json:"CgroupnsMode,omitempty"`
+
+	GroupAdd          []string          `json:"GroupAdd,omitempty"`
+	ReadonlyRootfs    bool              `json:"ReadonlyRootfs,omitempty"`
+	Mounts            []apiMount        `json:"Mounts,omitempty"`
+	Tmpfs             map[string]string `json:"Tmpfs,omitempty"`
+	ShmSize           int64             `json:"ShmSize,omitempty"`
+	CapAdd            []string          `json:"CapAdd,omitempty"`
+	CapDrop           []string          `json:"CapDrop,omitempty"`
+	SecurityOpt       []string          `json:"SecurityOpt,omitempty"`
+	Ulimits           []apiUlimit       `json:"Ulimits,omitempty"`
+	Devices           []apiDevice       `json:"Devices,omitempty"`
+	DeviceCgroupRules []string          `json:"DeviceCgroupRules,omitempty"`
+	Sysctls           map[string]string `json:"Sysctls,omitempty"`
+
+	Memory               int64               `json:"Memory,omitempty"`
+	MemoryReservation    int64               `json:"MemoryReservation,omitempty"`
+	MemorySwap           int64               `json:"MemorySwap,omitempty"`
+	KernelMemory         int64               `json:"KernelMemory,omitempty"`
+	MemorySwappiness     *int64              `json:"MemorySwappiness,omitempty"`
+	OomKillDisable       bool                `json:"OomKillDisable,omitempty"`
+	OomScoreAdj          int                 `json:"OomScoreAdj,omitempty"`
+	CPUShares            int64               `json:"CpuShares,omitempty"`
+	CPUQuota             int64               `json:"CpuQuota,omitempty"`
+	CPUPeriod            int64               `json:"CpuPeriod,omitempty"`
+	CPURealtimeRuntime   int64               `json:"CpuRealtimeRuntime,omitempty"`
+	CPURealtimePeriod    int64               `json:"CpuRealtimePeriod,omitempty"`
+	CpusetCpus           string              `json:"CpusetCpus,omitempty"`
+	CpusetMems           string              `json:"CpusetMems,omitempty"`
+	PidsLimit            int64               `json:"PidsLimit,omitempty"`
+	BlkioWeight          uint16              `json:"BlkioWeight,omitempty"`
+	BlkioWeightDevice    []apiWeightDevice   `json:"BlkioWeightDevice,omitempty"`
+	BlkioDeviceReadBps   []apiThrottleDevice `json:"BlkioDeviceReadBps,omitempty"`
+	BlkioDeviceWriteBps  []apiThrottleDevice `json:"BlkioDeviceWriteBps,omitempty"`
+	BlkioDeviceReadIOps  []apiThrottleDevice `json:"BlkioDeviceReadIOps,omitempty"`
+	BlkioDeviceWriteIOps []apiThrottleDevice `json:"BlkioDeviceWriteIOps,omitempty"`
+}
+
+type apiMount struct {
+	Type        string          `json:"Type"`
+	Source      string          `json:"Source,omitempty"`
+	Target      string          `json:"Target"`
+	ReadOnly    bool            `json:"ReadOnly,omitempty"`
+	BindOptions *apiBindOptions `json:"BindOptions,omitempty"`
+}
+
+type apiBindOptions struct {
+	Propagation string `json:"Propagation"`
+}
+
+type apiUlimit struct {
+	Name string `json:"Name"`
+	Soft int64  `json:"Soft"`
+	Hard int64  `json:"Hard"`
+}
+
+type apiDevice struct {
+	PathOnHost        string `json:"PathOnHost"`
+	PathInContainer   string `json:"PathInContainer"`
+	CgroupPermissions string `json:"CgroupPermissions"`
+}
+
+type apiWeightDevice struct {
+	Path   string `json:"Path"`
+	Weight uint16 `json:"Weight"`
+}
+
+type apiThrottleDevice struct {
+	Path string `json:"Path"`
+	Rate uint64 `json:"Rate"`
+}
+
+// newHostConfig describes rc as the HostConfig of a container.
+func newHostConfig(rc *runtimeConfig) hostConfig {
+	hc := hostConfig{
+		NetworkMode:  rc.NetworkMode,
+		PidMode:      rc.PidMode,
+		IpcMode:      rc.IpcMode,
+		UTSMode:      rc.UTSMode,
+		UsernsMode:   rc.UsernsMode,
+		CgroupnsMode: rc.CgroupnsMode,
+
+		ReadonlyRootfs: rc.ReadOnly,
+		ShmSize:        rc.ShmSize,
+		CapAdd:         rc.CapAdd,
+		CapDrop:        rc.CapDrop,
+		SecurityOpt:    rc.securityOpts(),
+		Sysctls:        rc.Sysctls,
+
+		DeviceCgroupRules: rc.DeviceCgroupRules,
+
+		Memory:             rc.Memory,
+		MemoryReservation:  rc.MemoryReservation,
+		MemorySwap:         rc.MemorySwap,
+		KernelMemory:       rc.KernelMemory,
+		MemorySwappiness:   rc.MemorySwappiness,
+		OomKillDisable:     rc.OomKillDisable,
+		OomScoreAdj:        rc.OomScoreAdj,
+		CPUShares:          rc.CPUShares,
+		CPUQuota:           rc.CPUQuota,
+		CPUPeriod:          rc.CPUPeriod,
+		CPURealtimeRuntime: rc.CPURealtimeRuntime,
+		CPURealtimePeriod:  rc.CPURealtimePeriod,
+		CpusetCpus:         rc.CpusetCpus,
+		CpusetMems:         rc.CpusetMems,
+		PidsLimit:          rc.PidsLimit,
+		BlkioWeight:        rc.BlkioWeight,
+
+		BlkioDeviceReadBps:   apiThrottleDevices(rc.BlkioDeviceReadBps),
+		BlkioDeviceWriteBps:  apiThrottleDevices(rc.BlkioDeviceWriteBps),
+		BlkioDeviceReadIOps:  apiThrottleDevices(rc.BlkioDeviceReadIOps),
+		BlkioDeviceWriteIOps: apiThrottleDevices(rc.BlkioDeviceWriteIOps),
+	}
+	for _, gid := range rc.User.AdditionalGids {
+		hc.GroupAdd = append(hc.GroupAdd, fmt.Sprint(gid))
+	}
+	for _, m := range rc.Mounts {
+		if m.Type == "tmpfs" {
+			if hc.Tmpfs == nil {
+				hc.Tmpfs = make(map[string]string)
+			}
+			hc.Tmpfs[m.Target] = strings.Join(m.Options, ",")
+			continue
+		}
+		am := apiMount{Type: m.Type, Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly}
+		if m.Propagation != "" {
+			am.BindOptions = &apiBindOptions{Propagation: m.Propagation}
+		}
+		hc.Mounts = append(hc.Mounts, am)
+	}
+	for _, u := range rc.Ulimits {
+		hc.Ulimits = append(hc.Ulimits, apiUlimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+	for _, d := range rc.Devices {
+		hc.Devices = append(hc.Devices, apiDevice{
+			PathOnHost:        d.PathOnHost,
+			PathInContainer:   d.PathInContainer,
+			CgroupPermissions: d.CgroupPermissions,
+		})
+	}
+	for _, d := range rc.BlkioWeightDevice {
+		hc.BlkioWeightDevice = append(hc.BlkioWeightDevice, apiWeightDevice{Path: d.Path, Weight: d.Weight})
+	}
+	return hc
+}
+
+func apiThrottleDevices(devices []throttleDevice) []apiThrottleDevice {
+	var api []apiThrottleDevice
+	for _, d := range devices {
+		api = append(api, apiThrottleDevice{Path: d.Path, Rate: d.Rate})
+	}
+	return api
+}
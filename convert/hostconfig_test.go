@@ -0,0 +1,66 @@
+package convert
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestNewHostConfig(t *testing.T) {
+	swappiness := int64(0)
+	rc := &runtimeConfig{
+		NetworkMode: "none",
+		User:        specs.User{AdditionalGids: []uint32{10}},
+		ReadOnly:    true,
+		Mounts: []runtimeMount{
+			{Type: "tmpfs", Target: "/tmp"},
+			{Type: "tmpfs", Target: "/run", Options: []string{"ro", "size=1m"}},
+			{Type: "bind", Source: "/srv", Target: "/data", Propagation: "rslave"},
+		},
+		Ulimits:             []ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+		Devices:             []deviceMapping{{"/dev/fuse", "/dev/fuse", "rwm"}},
+		MemorySwappiness:    &swappiness,
+		BlkioWeightDevice:   []weightDevice{{Path: "/dev/sda", Weight: 200}},
+		BlkioDeviceWriteBps: []throttleDevice{{Path: "/dev/sda", Rate: 1 << 20}},
+	}
+	want := hostConfig{
+		NetworkMode:    "none",
+		GroupAdd:       []string{"10"},
+		ReadonlyRootfs: true,
+		Mounts: []apiMount{
+			{Type: "bind", Source: "/srv", Target: "/data", BindOptions: &apiBindOptions{Propagation: "rslave"}},
+		},
+		Tmpfs:               map[string]string{"/tmp": "", "/run": "ro,size=1m"},
+		Ulimits:             []apiUlimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+		Devices:             []apiDevice{{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"}},
+		MemorySwappiness:    &swappiness,
+		BlkioWeightDevice:   []apiWeightDevice{{Path: "/dev/sda", Weight: 200}},
+		BlkioDeviceWriteBps: []apiThrottleDevice{{Path: "/dev/sda", Rate: 1 << 20}},
+	}
+	got := newHostConfig(rc)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// A swappiness of 0 is written, a missing one is left to Docker.
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := fields["MemorySwappiness"]; !ok || v != float64(0) {
+		t.Errorf("got MemorySwappiness %v, %v, want 0", v, ok)
+	}
+	data, err = json.Marshal(newHostConfig(&runtimeConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{}" {
+		t.Errorf("got %s for an empty runtime configuration, want {}", data)
+	}
+}
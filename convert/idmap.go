@@ -0,0 +1,53 @@
+package convert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// idMap translates host IDs found on rootfs files back to the IDs the
+// container sees, undoing the shift of a user-namespaced bundle.
+type idMap []specs.IDMapping
+
+// toContainer returns the container ID for the host ID id, and whether
+// any mapping covers it.
+func (m idMap) toContainer(id int) (int, bool) {
+	for _, r := range m {
+		if id >= int(r.HostID) && id-int(r.HostID) < int(r.Size) {
+			return int(r.ContainerID) + id - int(r.HostID), true
+		}
+	}
+	return id, false
+}
+
+// ParseIDMappings parses ID mappings given on the command line as
+// containerID:hostID:size.
+func ParseIDMappings(values []string) ([]specs.IDMapping, error) {
+	var mappings []specs.IDMapping
+	for _, v := range values {
+		fields := strings.Split(v, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid id mapping %q, expected containerID:hostID:size", v)
+		}
+		var ids [3]uint32
+		for i, f := range fields {
+			n, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid id mapping %q: %v", v, err)
+			}
+			ids[i] = uint32(n)
+		}
+		if ids[2] == 0 {
+			return nil, fmt.Errorf("invalid id mapping %q: size must not be zero", v)
+		}
+		mappings = append(mappings, specs.IDMapping{
+			ContainerID: ids[0],
+			HostID:      ids[1],
+			Size:        ids[2],
+		})
+	}
+	return mappings, nil
+}
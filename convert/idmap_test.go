@@ -0,0 +1,74 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestParseIDMappings(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []specs.IDMapping
+		err    string
+	}{
+		{values: nil, want: nil},
+		{
+			values: []string{"0:100000:65536"},
+			want:   []specs.IDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}},
+		},
+		{
+			values: []string{"0:1000:1", "1:100000:65535"},
+			want: []specs.IDMapping{
+				{ContainerID: 0, HostID: 1000, Size: 1},
+				{ContainerID: 1, HostID: 100000, Size: 65535},
+			},
+		},
+		{values: []string{"0:100000"}, err: "expected containerID:hostID:size"},
+		{values: []string{"0:1:2:3"}, err: "expected containerID:hostID:size"},
+		{values: []string{"0:-1:10"}, err: "invalid syntax"},
+		{values: []string{"0:x:10"}, err: "invalid syntax"},
+		{values: []string{"0:4294967296:1"}, err: "out of range"},
+		{values: []string{"0:100000:0"}, err: "size must not be zero"},
+		{values: []string{"0:0:1", "bad"}, err: `invalid id mapping "bad"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseIDMappings(tt.values)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseIDMappings(%q): got error %v, want %q", tt.values, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseIDMappings(%q) = %v, %v, want %v", tt.values, got, err, tt.want)
+		}
+	}
+}
+
+func TestIDMapToContainer(t *testing.T) {
+	m := idMap{
+		{ContainerID: 0, HostID: 100000, Size: 1000},
+		{ContainerID: 1000, HostID: 2000, Size: 1},
+	}
+	tests := []struct {
+		id     int
+		want   int
+		mapped bool
+	}{
+		{100000, 0, true},
+		{100999, 999, true},
+		{101000, 101000, false},
+		{2000, 1000, true},
+		{2001, 2001, false},
+		{0, 0, false},
+	}
+	for _, tt := range tests {
+		got, mapped := m.toContainer(tt.id)
+		if got != tt.want || mapped != tt.mapped {
+			t.Errorf("toContainer(%d) = %d, %v, want %d, %v", tt.id, got, mapped, tt.want, tt.mapped)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the exclude file looked up in the bundle.
+const IgnoreFile = ".ociignore"
+
+// ignorePattern is one line of an exclude file.
+type ignorePattern struct {
+	pattern string
+	negate  bool
+}
+
+// ignoreMatcher decides which rootfs paths are left out of the image. It
+// follows .dockerignore rules: patterns are relative to the rootfs, `**`
+// matches any number of directories, a pattern matching a directory
+// excludes everything below it, and the last matching line wins, so `!`
+// lines can re-include files.
+type ignoreMatcher struct {
+	patterns []ignorePattern
+}
+
+// ignoreStats counts what an ignoreMatcher left out of a layer. Files and
+// Bytes include the files inside excluded directory trees.
+type ignoreStats struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	Dirs  int   `json:"dirs"`
+}
+
+func parseIgnore(r io.Reader) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(line)), "/")
+		if line == "" {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("bad exclude pattern %q: %v", line, err)
+		}
+		p.pattern = line
+		m.patterns = append(m.patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadIgnore reads the exclude file given on the command line, falling back
+// to IgnoreFile at the top of the bundle. It returns nil if there is none.
+func loadIgnore(bundle string, file string) (*ignoreMatcher, error) {
+	if file == "" {
+		file = filepath.Join(bundle, IgnoreFile)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := parseIgnore(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return m, nil
+}
+
+// excluded reports whether the slash-separated rootfs path rpath is left out.
+func (m *ignoreMatcher) excluded(rpath string) bool {
+	i := m.lastMatch(rpath)
+	return i >= 0 && !m.patterns[i].negate
+}
+
+// lastMatch returns the index of the last pattern matching rpath, or -1.
+func (m *ignoreMatcher) lastMatch(rpath string) int {
+	if m == nil {
+		return -1
+	}
+	last := -1
+	for i, p := range m.patterns {
+		if matchIgnore(p.pattern, rpath) {
+			last = i
+		}
+	}
+	return last
+}
+
+// mayReinclude reports whether a ! line could re-include a path below the
+// excluded directory rdir. The pattern excluding rdir matches everything
+// below it, so only the ! lines after it count.
+func (m *ignoreMatcher) mayReinclude(rdir string) bool {
+	dir := strings.Split(rdir, "/")
+	for _, p := range m.patterns[m.lastMatch(rdir)+1:] {
+		if p.negate && matchPrefix(strings.Split(p.pattern, "/"), dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchIgnore matches rpath or any of its parent directories against pattern.
+func matchIgnore(pattern string, rpath string) bool {
+	pp := strings.Split(pattern, "/")
+	fp := strings.Split(rpath, "/")
+	for n := len(fp); n > 0; n-- {
+		if matchSegments(pp, fp[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix reports whether pattern could match a path below the
+// directory with the segments dir.
+func matchPrefix(pattern []string, dir []string) bool {
+	for ; len(pattern) > 0 && len(dir) > 0; pattern, dir = pattern[1:], dir[1:] {
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], dir[0]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func matchSegments(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
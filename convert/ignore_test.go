@@ -0,0 +1,114 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIgnore(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []ignorePattern
+		err   string
+	}{
+		{
+			input: "# comment\n\n*.log\n  tmp/  \n",
+			want:  []ignorePattern{{pattern: "*.log"}, {pattern: "tmp"}},
+		},
+		{
+			input: "/var/cache/../log\n! var/log/keep\n!\n/\n",
+			want:  []ignorePattern{{pattern: "var/log"}, {pattern: "var/log/keep", negate: true}},
+		},
+		{
+			input: "../../etc\n",
+			want:  []ignorePattern{{pattern: "etc"}},
+		},
+		{input: "[a-\n", err: "bad exclude pattern"},
+	}
+	for _, tt := range tests {
+		m, err := parseIgnore(strings.NewReader(tt.input))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseIgnore(%q): got error %v, want %q", tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseIgnore(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(m.patterns, tt.want) {
+			t.Errorf("parseIgnore(%q) = %v, want %v", tt.input, m.patterns, tt.want)
+		}
+	}
+}
+
+func TestIgnoreExcluded(t *testing.T) {
+	m, err := parseIgnore(strings.NewReader(`
+*.log
+tmp
+!tmp/keep
+**/cache
+docs/**/*.md
+!docs/README.md
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"app.log", true},
+		{"var/app.log", false},
+		{"tmp", true},
+		{"tmp/x", true},
+		{"tmp/keep", false},
+		{"tmp/keep/file", false},
+		{"tmp/keeper", true},
+		{"cache", true},
+		{"var/lib/cache/x", true},
+		{"docs/guide.md", true},
+		{"docs/a/b/guide.md", true},
+		{"docs/README.md", false},
+		{"docs/guide.txt", false},
+		{"src/main.go", false},
+	}
+	for _, tt := range tests {
+		if got := m.excluded(tt.path); got != tt.want {
+			t.Errorf("excluded(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	var none *ignoreMatcher
+	if none.excluded("anything") {
+		t.Errorf("nil matcher excluded a path")
+	}
+}
+
+func TestIgnoreMayReinclude(t *testing.T) {
+	tests := []struct {
+		patterns string
+		dir      string
+		want     bool
+	}{
+		{"tmp\n!tmp/keep\n", "tmp", true},
+		{"tmp\n!tmp/keep\n", "tmp/other", false},
+		{"tmp\n!tmp/keep\n", "var", false},
+		{"tmp\n!tmp/keep\ntmp\n", "tmp", false},
+		{"!tmp/keep\ntmp\n", "tmp", false},
+		{"tmp\n!**/keep\n", "tmp", true},
+		{"tmp\n!*/keep\n", "tmp", true},
+		{"a/b\n!a/c/file\n", "a/b", false},
+	}
+	for _, tt := range tests {
+		m, err := parseIgnore(strings.NewReader(tt.patterns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.mayReinclude(tt.dir); got != tt.want {
+			t.Errorf("mayReinclude(%q) with %q = %v, want %v", tt.dir, tt.patterns, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// descriptor references a blob by media type, digest and size.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// imageConfig is the image configuration blob shared by Docker and OCI.
+type imageConfig struct {
+	Created      string          `json:"created,omitempty"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Config       containerConfig `json:"config"`
+	RootFS       rootFS          `json:"rootfs"`
+	History      []history       `json:"history,omitempty"`
+}
+
+// containerConfig is the configuration of the containers run from the
+// image. It declares no Volumes: the mounts of a bundle are runtime
+// settings, and image volumes would have Docker create anonymous volumes at
+// their targets on every run.
+type containerConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+type rootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type history struct {
+	Created   string `json:"created,omitempty"`
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+type imageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+// historyCreatedBy is the history entry of the single layer of the image.
+const historyCreatedBy = "oci2docker convert"
+
+// annotationAuthors is the bundle annotation naming the maintainers of the
+// image, which becomes its maintainer label.
+const annotationAuthors = "org.opencontainers.image.authors"
+
+// newImageConfig maps the bundle configuration to an image configuration,
+// following the same rules as the generated Dockerfile.
+func newImageConfig(path string, ports []string) (*imageConfig, error) {
+	spec := getConfigSpec(path)
+	if spec == nil {
+		return nil, ErrNoConfig
+	}
+
+	cfg := &imageConfig{
+		Architecture: spec.Platform.Arch,
+		OS:           spec.Platform.OS,
+	}
+	if cfg.Architecture == "" {
+		cfg.Architecture = "amd64"
+	}
+	if cfg.OS == "" {
+		cfg.OS = "linux"
+	}
+
+	entrypoint, workdir := getEntrypointFromSpecs(path)
+	if entrypoint != "" {
+		cfg.Config.Entrypoint = []string{entrypoint}
+	}
+	cfg.Config.WorkingDir = workdir
+	cfg.Config.Env = spec.Process.Env
+	cfg.Config.User = getUserFromSpecs(path)
+	cfg.Config.Cmd = strings.Fields(getPoststartFromSpecs(path))
+	if authors := spec.Annotations[annotationAuthors]; authors != "" {
+		cfg.Config.Labels = map[string]string{"maintainer": authors}
+	}
+
+	exposed, err := parsePorts(annotationPorts(spec.Annotations))
+	if err != nil {
+		return nil, fmt.Errorf("annotations: %v", err)
+	}
+	for _, p := range exposed {
+		ports = append(ports, p.String())
+	}
+	for _, p := range ports {
+		if cfg.Config.ExposedPorts == nil {
+			cfg.Config.ExposedPorts = make(map[string]struct{})
+		}
+		cfg.Config.ExposedPorts[p] = struct{}{}
+	}
+
+	return cfg, nil
+}
+
+// imageLayout is an OCI image layout directory used as the on-disk output
+// of the conversion, whichever manifest format is chosen.
+type imageLayout struct {
+	dir string
+}
+
+func newImageLayout(dir string) (*imageLayout, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, err
+	}
+	layout := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "oci-layout"), layout, 0644); err != nil {
+		return nil, err
+	}
+	return &imageLayout{dir: dir}, nil
+}
+
+func (l *imageLayout) blobDir() string {
+	return filepath.Join(l.dir, "blobs", "sha256")
+}
+
+// blobPath returns the file holding the blob with the given digest.
+func (l *imageLayout) blobPath(digest string) string {
+	return filepath.Join(l.blobDir(), strings.TrimPrefix(digest, "sha256:"))
+}
+
+// putJSON stores v as a blob and returns its descriptor.
+func (l *imageLayout) putJSON(mediaType string, v interface{}) (descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return descriptor{}, err
+	}
+	sum := sha256.Sum256(data)
+	if err := ioutil.WriteFile(filepath.Join(l.blobDir(), fmt.Sprintf("%x", sum)), data, 0644); err != nil {
+		return descriptor{}, err
+	}
+	return descriptor{
+		MediaType: mediaType,
+		Digest:    fmt.Sprintf("sha256:%x", sum),
+		Size:      int64(len(data)),
+	}, nil
+}
+
+// writeIndex records the given manifests as the entry points of the layout.
+func (l *imageLayout) writeIndex(manifests []descriptor) error {
+	data, err := json.Marshal(imageIndex{SchemaVersion: 2, Manifests: manifests})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(l.dir, "index.json"), data, 0644)
+}
+
+// writeImage converts the bundle at path into a single-layer image and
+// stores it in the image layout at opts.Output.
+func writeImage(path string, opts Options) (descriptor, error) {
+	layout, err := newImageLayout(opts.Output)
+	if err != nil {
+		return descriptor{}, fmt.Errorf("creating image layout: %v", err)
+	}
+	manifestDesc, _, err := writeImageManifest(layout, path, opts)
+	if err != nil {
+		return descriptor{}, err
+	}
+	if err := layout.writeIndex(namedDescriptors(manifestDesc, opts.ImageNames)); err != nil {
+		return descriptor{}, err
+	}
+	return manifestDesc, nil
+}
+
+// namedDescriptors returns one copy of desc per image name, annotated with
+// the name, for index.json.
+func namedDescriptors(desc descriptor, names []string) []descriptor {
+	if len(names) == 0 {
+		return []descriptor{desc}
+	}
+	var descs []descriptor
+	for _, name := range names {
+		d := desc
+		d.Annotations = map[string]string{
+			"org.opencontainers.image.ref.name": name,
+		}
+		descs = append(descs, d)
+	}
+	return descs
+}
+
+// writeImageManifest stores the layer, configuration and manifest of the
+// bundle at path in layout. The returned descriptor carries the platform of
+// the image.
+func writeImageManifest(layout *imageLayout, path string, opts Options) (descriptor, *imageConfig, error) {
+	cfg, err := newImageConfig(path, opts.Ports)
+	if err != nil {
+		return descriptor{}, nil, err
+	}
+	a, err := newArchiver(path, opts)
+	if err != nil {
+		return descriptor{}, nil, err
+	}
+	if err := checkRootfs(path, a); err != nil {
+		return descriptor{}, nil, err
+	}
+	layer, err := writeLayerBlob(layout.blobDir(), a, opts.Format, opts.Compression)
+	if err != nil {
+		return descriptor{}, nil, err
+	}
+
+	created := time.Now().UTC().Format(time.RFC3339)
+	cfg.Created = created
+	cfg.RootFS = rootFS{Type: "layers", DiffIDs: []string{layer.DiffID}}
+	cfg.History = []history{{Created: created, CreatedBy: historyCreatedBy}}
+
+	configType, manifestType := mediaTypeDockerConfig, mediaTypeDockerManifest
+	if opts.Format == FormatOCI {
+		configType, manifestType = mediaTypeOCIConfig, mediaTypeOCIManifest
+	}
+	configDesc, err := layout.putJSON(configType, cfg)
+	if err != nil {
+		return descriptor{}, nil, err
+	}
+	m := manifest{
+		SchemaVersion: 2,
+		MediaType:     manifestType,
+		Config:        configDesc,
+		Layers:        []descriptor{layer.descriptor},
+	}
+	manifestDesc, err := layout.putJSON(manifestType, m)
+	if err != nil {
+		return descriptor{}, nil, err
+	}
+	manifestDesc.Platform = &platform{Architecture: cfg.Architecture, OS: cfg.OS}
+
+	logrus.Debugf("Layer %s: %d bytes, diffID %s", layer.Digest, layer.Size, layer.DiffID)
+	return manifestDesc, cfg, nil
+}
@@ -0,0 +1,229 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// writeTestSpec writes spec as the config.json of bundle.
+func writeTestSpec(t *testing.T, bundle string, spec *specs.Spec) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundle, ConfigFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewImageConfig(t *testing.T) {
+	bundle, err := ioutil.TempDir("", "oci2docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bundle)
+
+	tests := []struct {
+		name        string
+		arch, os    string
+		args        []string
+		poststart   *specs.Hook
+		annotations map[string]string
+		ports       []string
+		want        imageConfig
+		err         string
+	}{
+		{
+			name: "defaults",
+			want: imageConfig{
+				Architecture: "amd64",
+				OS:           "linux",
+				Config:       containerConfig{User: "0:0", Entrypoint: []string{"/bin/sh"}, Cmd: []string{}},
+			},
+		},
+		{
+			name: "empty args",
+			args: []string{},
+			want: imageConfig{
+				Architecture: "amd64",
+				OS:           "linux",
+				Config:       containerConfig{User: "0:0", Entrypoint: []string{"/bin/sh"}, Cmd: []string{}},
+			},
+		},
+		{
+			name:        "bundle",
+			arch:        "arm64",
+			os:          "linux",
+			args:        []string{"/bin/app", "--ignored"},
+			poststart:   &specs.Hook{Path: "/bin/serve", Args: []string{"--port", "80"}},
+			annotations: map[string]string{annotationAuthors: "cts <cts@example.com>", "org.opencontainers.image.exposedPorts": "80,53/udp"},
+			ports:       []string{"8080/tcp"},
+			want: imageConfig{
+				Architecture: "arm64",
+				OS:           "linux",
+				Config: containerConfig{
+					User:         "0:0",
+					ExposedPorts: map[string]struct{}{"8080/tcp": {}, "80/tcp": {}, "53/udp": {}},
+					Entrypoint:   []string{"/bin/app"},
+					Cmd:          []string{"/bin/serve", "--port", "80"},
+					WorkingDir:   "/",
+					Labels:       map[string]string{"maintainer": "cts <cts@example.com>"},
+				},
+			},
+		},
+		{
+			name:        "invalid port annotation",
+			annotations: map[string]string{"org.opencontainers.image.exposedPorts": "http"},
+			err:         "annotations: ",
+		},
+	}
+	for _, tt := range tests {
+		spec := &specs.Spec{Annotations: tt.annotations}
+		spec.Platform.Arch, spec.Platform.OS = tt.arch, tt.os
+		spec.Process.Args = tt.args
+		if tt.args != nil {
+			spec.Process.Cwd = "/"
+		}
+		if tt.poststart != nil {
+			spec.Hooks.Poststart = []specs.Hook{*tt.poststart}
+		}
+		writeTestSpec(t, bundle, spec)
+
+		cfg, err := newImageConfig(bundle, tt.ports)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*cfg, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *cfg, tt.want)
+		}
+	}
+
+	if _, err := newImageConfig(filepath.Join(bundle, "missing"), nil); err != ErrNoConfig {
+		t.Errorf("got error %v for a bundle without config.json, want %v", err, ErrNoConfig)
+	}
+}
+
+func TestWriteImage(t *testing.T) {
+	bundle := writePlatformBundle(t, "linux", "amd64", "amd64")
+	defer os.RemoveAll(bundle)
+
+	tests := []struct {
+		format       ImageFormat
+		compression  Compression
+		manifestType string
+		configType   string
+		err          string
+	}{
+		{FormatDocker, CompressionGzip, mediaTypeDockerManifest, mediaTypeDockerConfig, ""},
+		{FormatDocker, CompressionNone, mediaTypeDockerManifest, mediaTypeDockerConfig, ""},
+		{FormatOCI, CompressionGzip, mediaTypeOCIManifest, mediaTypeOCIConfig, ""},
+		{FormatOCI, CompressionZstd, mediaTypeOCIManifest, mediaTypeOCIConfig, ""},
+		{FormatOCI, CompressionNone, mediaTypeOCIManifest, mediaTypeOCIConfig, ""},
+		{FormatDocker, CompressionZstd, "", "", "zstd compression is not supported by the docker image format"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s", tt.format, tt.compression), func(t *testing.T) {
+			out, err := ioutil.TempDir("", "oci2docker-image")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(out)
+			opts := Options{
+				Output:      out,
+				Format:      tt.format,
+				Compression: tt.compression,
+				ImageNames:  []string{"cts/app:1.0", "cts/app:latest"},
+			}
+
+			desc, err := writeImage(bundle, opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			layout := &imageLayout{dir: out}
+			readBlob := func(d descriptor, v interface{}) []byte {
+				data, err := ioutil.ReadFile(layout.blobPath(d.Digest))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(data)) != d.Size || fmt.Sprintf("sha256:%x", sha256.Sum256(data)) != d.Digest {
+					t.Fatalf("blob %s does not match its descriptor", d.Digest)
+				}
+				if v != nil {
+					if err := json.Unmarshal(data, v); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return data
+			}
+
+			var index imageIndex
+			data, err := ioutil.ReadFile(filepath.Join(out, "index.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, m := range index.Manifests {
+				if m.Digest != desc.Digest {
+					t.Errorf("index.json names manifest %s, want %s", m.Digest, desc.Digest)
+				}
+				names = append(names, m.Annotations["org.opencontainers.image.ref.name"])
+			}
+			if !reflect.DeepEqual(names, opts.ImageNames) {
+				t.Errorf("got names %q, want %q", names, opts.ImageNames)
+			}
+
+			var m manifest
+			readBlob(desc, &m)
+			if desc.MediaType != tt.manifestType || m.MediaType != tt.manifestType || m.Config.MediaType != tt.configType {
+				t.Errorf("got manifest %s (%s) with config %s", desc.MediaType, m.MediaType, m.Config.MediaType)
+			}
+			var cfg imageConfig
+			readBlob(m.Config, &cfg)
+			if len(m.Layers) != 1 || len(cfg.RootFS.DiffIDs) != 1 || len(cfg.History) != 1 || cfg.History[0].CreatedBy != historyCreatedBy {
+				t.Fatalf("got %d layers, config %+v", len(m.Layers), cfg)
+			}
+			layerType, _ := layerMediaType(tt.format, tt.compression)
+			if m.Layers[0].MediaType != layerType {
+				t.Errorf("got layer media type %s, want %s", m.Layers[0].MediaType, layerType)
+			}
+
+			r, err := decompressStream(strings.NewReader(string(readBlob(m.Layers[0], nil))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			tarData, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diffID := fmt.Sprintf("sha256:%x", sha256.Sum256(tarData)); diffID != cfg.RootFS.DiffIDs[0] {
+				t.Errorf("got diffID %s, the layer has %s", cfg.RootFS.DiffIDs[0], diffID)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package convert
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// ReportFormat is the encoding of the reports printed by oci2docker.
+type ReportFormat string
+
+const (
+	// ReportJSON prints reports as indented JSON.
+	ReportJSON ReportFormat = "json"
+	// ReportYAML prints reports as YAML.
+	ReportYAML ReportFormat = "yaml"
+)
+
+// largestDirs is how many directories the rootfs statistics list.
+const largestDirs = 10
+
+// ParseReportFormat checks the report format named on the command line.
+func ParseReportFormat(name string) (ReportFormat, error) {
+	switch f := ReportFormat(name); f {
+	case ReportJSON, ReportYAML:
+		return f, nil
+	case "":
+		return ReportJSON, nil
+	}
+	return "", fmt.Errorf("unknown report format %q, expected json or yaml", name)
+}
+
+// marshalReport encodes v in format f.
+func marshalReport(v interface{}, f ReportFormat) ([]byte, error) {
+	if f == ReportYAML {
+		return marshalYAML(v)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// imagePlan is what converting a bundle would produce.
+type imagePlan struct {
+	Platform platform      `json:"platform"`
+	Config   plannedConfig `json:"config"`
+	History  []history     `json:"history"`
+	Rootfs   rootfsStats   `json:"rootfs"`
+	// Errors lists the problems that would fail the conversion.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// plannedConfig is a containerConfig with every field listed, set or not,
+// so that the report shows the whole configuration that will be written.
+type plannedConfig struct {
+	User         string              `json:"User"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	Env          []string            `json:"Env"`
+	Entrypoint   []string            `json:"Entrypoint"`
+	Cmd          []string            `json:"Cmd"`
+	WorkingDir   string              `json:"WorkingDir"`
+	Labels       map[string]string   `json:"Labels"`
+}
+
+func newPlannedConfig(c containerConfig) plannedConfig {
+	p := plannedConfig{
+		User:         c.User,
+		ExposedPorts: c.ExposedPorts,
+		Env:          c.Env,
+		Entrypoint:   c.Entrypoint,
+		Cmd:          c.Cmd,
+		WorkingDir:   c.WorkingDir,
+		Labels:       c.Labels,
+	}
+	if p.ExposedPorts == nil {
+		p.ExposedPorts = map[string]struct{}{}
+	}
+	if p.Env == nil {
+		p.Env = []string{}
+	}
+	if p.Entrypoint == nil {
+		p.Entrypoint = []string{}
+	}
+	if p.Cmd == nil {
+		p.Cmd = []string{}
+	}
+	if p.Labels == nil {
+		p.Labels = map[string]string{}
+	}
+	return p
+}
+
+type rootfsStats struct {
+	Files       int         `json:"files"`
+	Directories int         `json:"directories"`
+	Size        int64       `json:"size"`
+	Excluded    ignoreStats `json:"excluded"`
+	Largest     []dirUsage  `json:"largestDirectories"`
+}
+
+// dirUsage is the size of everything below a directory.
+type dirUsage struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// RunInspect prints the image configuration and rootfs statistics the
+// conversion of the bundle at path would produce, without building
+// anything.
+func RunInspect(path string, format ReportFormat, opts Options) {
+	setLogLevel(opts.Debug)
+
+	path, archive, err := openBundle(path)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	if archive != nil {
+		defer archive.Close()
+		opts.archive = archive
+	}
+
+	plan, err := planImage(path, opts)
+	if err != nil {
+		logrus.Infof("Inspect failed: %v", err)
+		return
+	}
+	data, err := marshalReport(plan, format)
+	if err != nil {
+		logrus.Infof("Inspect failed: %v", err)
+		return
+	}
+	os.Stdout.Write(data)
+}
+
+// planImage runs the mapping of the bundle at path and the rootfs checks of
+// a conversion. Failed checks are recorded in the plan, not returned.
+func planImage(path string, opts Options) (*imagePlan, error) {
+	cfg, err := newImageConfig(path, opts.Ports)
+	if err != nil {
+		return nil, err
+	}
+	a, err := newArchiver(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := a.indexRootfs()
+	if err != nil {
+		return nil, fmt.Errorf("reading the rootfs: %v", err)
+	}
+
+	plan := &imagePlan{
+		Platform: platform{Architecture: cfg.Architecture, OS: cfg.OS},
+		Config:   newPlannedConfig(cfg.Config),
+		History:  []history{{CreatedBy: historyCreatedBy}},
+		Rootfs:   idx.stats(),
+	}
+	plan.Rootfs.Excluded = a.skipped
+	if err := checkRootfsIndex(getConfigSpec(path), idx); err != nil {
+		plan.Errors = append(plan.Errors, err.Error())
+	}
+	return plan, nil
+}
+
+// stats counts the files of the rootfs and the space used below each
+// directory. Hard links are counted once.
+func (idx *rootfsIndex) stats() rootfsStats {
+	var s rootfsStats
+	dirs := make(map[string]*dirUsage)
+	for _, name := range idx.names {
+		e := idx.entries[name]
+		if e.isDir() {
+			s.Directories++
+			continue
+		}
+		s.Files++
+		size := int64(0)
+		if e.hdr.Typeflag == tar.TypeReg || e.hdr.Typeflag == tar.TypeRegA {
+			size = e.hdr.Size
+		}
+		s.Size += size
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			u, ok := dirs[dir]
+			if !ok {
+				u = &dirUsage{Path: "/" + dir}
+				dirs[dir] = u
+			}
+			u.Files++
+			u.Size += size
+		}
+	}
+
+	s.Largest = []dirUsage{}
+	for _, u := range dirs {
+		s.Largest = append(s.Largest, *u)
+	}
+	sort.Sort(bySize(s.Largest))
+	if len(s.Largest) > largestDirs {
+		s.Largest = s.Largest[:largestDirs]
+	}
+	return s
+}
+
+// bySize sorts directories largest first.
+type bySize []dirUsage
+
+func (s bySize) Len() int      { return len(s) }
+func (s bySize) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySize) Less(i, j int) bool {
+	if s[i].Size != s[j].Size {
+		return s[i].Size > s[j].Size
+	}
+	return s[i].Path < s[j].Path
+}
@@ -0,0 +1,153 @@
+package convert
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReportFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want ReportFormat
+		err  string
+	}{
+		{name: "", want: ReportJSON},
+		{name: "json", want: ReportJSON},
+		{name: "yaml", want: ReportYAML},
+		{name: "toml", err: `unknown report format "toml"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseReportFormat(tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseReportFormat(%q): got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseReportFormat(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewPlannedConfig(t *testing.T) {
+	data, err := json.Marshal(newPlannedConfig(containerConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"User":"","ExposedPorts":{},"Env":[],"Entrypoint":[],"Cmd":[],"WorkingDir":"","Labels":{}}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	c := containerConfig{
+		User:         "1000:1000",
+		ExposedPorts: map[string]struct{}{"80/tcp": {}},
+		Entrypoint:   []string{"/bin/app"},
+		Labels:       map[string]string{"maintainer": "cts"},
+	}
+	p := newPlannedConfig(c)
+	if p.User != c.User || !reflect.DeepEqual(p.ExposedPorts, c.ExposedPorts) ||
+		!reflect.DeepEqual(p.Entrypoint, c.Entrypoint) || !reflect.DeepEqual(p.Labels, c.Labels) {
+		t.Errorf("got %+v, want the fields of %+v", p, c)
+	}
+}
+
+func TestRootfsIndexStats(t *testing.T) {
+	entries := []testEntry{
+		{name: "bin/"},
+		{name: "bin/sh", content: "x"},
+		{name: "bin/ls", content: "x"},
+		{name: "usr/share/doc/README", mode: 0644},
+		{name: "usr/lib/libc.so", mode: 0644},
+		{name: "lib", link: "usr/lib"},
+	}
+	sizes := map[string]int64{"bin/sh": 100, "bin/ls": 50, "usr/share/doc/README": 10, "usr/lib/libc.so": 1000}
+	idx := newTestIndex(entries...)
+	for name, size := range sizes {
+		idx.entries[name].hdr.Size = size
+	}
+
+	got := idx.stats()
+	want := rootfsStats{
+		Files:       5,
+		Directories: 1,
+		Size:        1160,
+		Largest: []dirUsage{
+			{Path: "/usr", Files: 2, Size: 1010},
+			{Path: "/usr/lib", Files: 1, Size: 1000},
+			{Path: "/bin", Files: 2, Size: 150},
+			{Path: "/usr/share", Files: 1, Size: 10},
+			{Path: "/usr/share/doc", Files: 1, Size: 10},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	var many []testEntry
+	for i := 0; i < largestDirs+5; i++ {
+		many = append(many, testEntry{name: strings.Repeat("d", i+1) + "/file", mode: 0644})
+	}
+	if got := newTestIndex(many...).stats(); len(got.Largest) != largestDirs {
+		t.Errorf("got %d directories, want the %d largest", len(got.Largest), largestDirs)
+	}
+	if got := newTestIndex().stats(); got.Largest == nil {
+		t.Errorf("an empty rootfs lists no directories as null")
+	}
+}
+
+func TestPlanImage(t *testing.T) {
+	amd64 := writePlatformBundle(t, "linux", "amd64", "amd64", "PATH=/bin")
+	defer os.RemoveAll(amd64)
+	mismatch := writePlatformBundle(t, "linux", "amd64", "arm64")
+	defer os.RemoveAll(mismatch)
+
+	tests := []struct {
+		name   string
+		path   string
+		env    []string
+		errors []string
+		err    string
+	}{
+		{name: "valid", path: amd64, env: []string{"PATH=/bin"}},
+		{
+			name:   "failed check",
+			path:   mismatch,
+			env:    []string{},
+			errors: []string{"platform.arch is amd64 (64-bit LSB X86_64) but the rootfs does not match: /bin/app is 64-bit LSB AARCH64"},
+		},
+		{name: "no config", path: os.TempDir() + "/oci2docker-missing", err: ErrNoConfig.Error()},
+	}
+	for _, tt := range tests {
+		plan, err := planImage(tt.path, Options{})
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if plan.Platform != (platform{Architecture: "amd64", OS: "linux"}) {
+			t.Errorf("%s: got platform %+v", tt.name, plan.Platform)
+		}
+		if !reflect.DeepEqual(plan.Config.Entrypoint, []string{"/bin/app"}) || !reflect.DeepEqual(plan.Config.Env, tt.env) {
+			t.Errorf("%s: got config %+v", tt.name, plan.Config)
+		}
+		if !reflect.DeepEqual(plan.History, []history{{CreatedBy: historyCreatedBy}}) {
+			t.Errorf("%s: got history %+v", tt.name, plan.History)
+		}
+		if plan.Rootfs.Files != 1 || plan.Rootfs.Directories != 1 {
+			t.Errorf("%s: got rootfs statistics %+v", tt.name, plan.Rootfs)
+		}
+		if !reflect.DeepEqual(plan.Errors, tt.errors) {
+			t.Errorf("%s: got errors %q, want %q", tt.name, plan.Errors, tt.errors)
+		}
+	}
+}
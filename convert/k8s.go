@@ -0,0 +1,398 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// k8sPropagation maps mount propagation modes to Kubernetes mount
+// propagation.
+var k8sPropagation = map[string]string{
+	"private":  "None",
+	"rprivate": "None",
+	"slave":    "HostToContainer",
+	"rslave":   "HostToContainer",
+	"shared":   "Bidirectional",
+	"rshared":  "Bidirectional",
+}
+
+type k8sMetadata struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type k8sPod struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Metadata   k8sMetadata `json:"metadata"`
+	Spec       k8sPodSpec  `json:"spec"`
+}
+
+type k8sDeployment struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   k8sMetadata       `json:"metadata"`
+	Spec       k8sDeploymentSpec `json:"spec"`
+}
+
+type k8sDeploymentSpec struct {
+	Replicas int            `json:"replicas"`
+	Selector k8sSelector    `json:"selector"`
+	Template k8sPodTemplate `json:"template"`
+}
+
+type k8sSelector struct {
+	MatchLabels map[string]string `json:"matchLabels"`
+}
+
+type k8sPodTemplate struct {
+	Metadata k8sMetadata `json:"metadata"`
+	Spec     k8sPodSpec  `json:"spec"`
+}
+
+type k8sPodSpec struct {
+	Hostname        string                 `json:"hostname,omitempty"`
+	HostNetwork     bool                   `json:"hostNetwork,omitempty"`
+	HostPID         bool                   `json:"hostPID,omitempty"`
+	HostIPC         bool                   `json:"hostIPC,omitempty"`
+	SecurityContext *k8sPodSecurityContext `json:"securityContext,omitempty"`
+	Containers      []k8sContainer         `json:"containers"`
+	Volumes         []k8sVolume            `json:"volumes,omitempty"`
+}
+
+type k8sPodSecurityContext struct {
+	SupplementalGroups []uint32    `json:"supplementalGroups,omitempty"`
+	Sysctls            []k8sSysctl `json:"sysctls,omitempty"`
+}
+
+type k8sSysctl struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type k8sContainer struct {
+	Name            string             `json:"name"`
+	Image           string             `json:"image"`
+	Command         []string           `json:"command,omitempty"`
+	Env             []k8sEnvVar        `json:"env,omitempty"`
+	WorkingDir      string             `json:"workingDir,omitempty"`
+	Tty             bool               `json:"tty,omitempty"`
+	Stdin           bool               `json:"stdin,omitempty"`
+	SecurityContext k8sSecurityContext `json:"securityContext"`
+	Resources       *k8sResources      `json:"resources,omitempty"`
+	VolumeMounts    []k8sVolumeMount   `json:"volumeMounts,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type k8sSecurityContext struct {
+	RunAsUser                *int64              `json:"runAsUser,omitempty"`
+	RunAsGroup               *int64              `json:"runAsGroup,omitempty"`
+	AllowPrivilegeEscalation *bool               `json:"allowPrivilegeEscalation,omitempty"`
+	ReadOnlyRootFilesystem   bool                `json:"readOnlyRootFilesystem,omitempty"`
+	Capabilities             *k8sCapabilities    `json:"capabilities,omitempty"`
+	SELinuxOptions           *k8sSELinuxOptions  `json:"seLinuxOptions,omitempty"`
+	AppArmorProfile          *k8sAppArmorProfile `json:"appArmorProfile,omitempty"`
+}
+
+type k8sSELinuxOptions struct {
+	User  string `json:"user,omitempty"`
+	Role  string `json:"role,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Level string `json:"level,omitempty"`
+}
+
+type k8sAppArmorProfile struct {
+	Type             string `json:"type"`
+	LocalhostProfile string `json:"localhostProfile,omitempty"`
+}
+
+type k8sCapabilities struct {
+	Add  []string `json:"add,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+type k8sResources struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type k8sVolumeMount struct {
+	Name             string `json:"name"`
+	MountPath        string `json:"mountPath"`
+	ReadOnly         bool   `json:"readOnly,omitempty"`
+	MountPropagation string `json:"mountPropagation,omitempty"`
+}
+
+type k8sVolume struct {
+	Name     string           `json:"name"`
+	EmptyDir *k8sEmptyDir     `json:"emptyDir,omitempty"`
+	HostPath *k8sHostPathInfo `json:"hostPath,omitempty"`
+}
+
+type k8sEmptyDir struct {
+	Medium    string `json:"medium,omitempty"`
+	SizeLimit string `json:"sizeLimit,omitempty"`
+}
+
+type k8sHostPathInfo struct {
+	Path string `json:"path"`
+}
+
+// newKubernetesPod describes rc as a Pod running a single container.
+func newKubernetesPod(rc *runtimeConfig) k8sPod {
+	name := serviceName(rc.Image)
+	return k8sPod{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata:   k8sMetadata{Name: name, Labels: map[string]string{"app": name}},
+		Spec:       newKubernetesPodSpec(rc),
+	}
+}
+
+// newKubernetesDeployment describes rc as a Deployment of one replica of
+// the Pod newKubernetesPod describes.
+func newKubernetesDeployment(rc *runtimeConfig) k8sDeployment {
+	name := serviceName(rc.Image)
+	labels := map[string]string{"app": name}
+	return k8sDeployment{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   k8sMetadata{Name: name, Labels: labels},
+		Spec: k8sDeploymentSpec{
+			Replicas: 1,
+			Selector: k8sSelector{MatchLabels: labels},
+			Template: k8sPodTemplate{
+				Metadata: k8sMetadata{Name: name, Labels: labels},
+				Spec:     newKubernetesPodSpec(rc),
+			},
+		},
+	}
+}
+
+func newKubernetesPodSpec(rc *runtimeConfig) k8sPodSpec {
+	uid, gid := int64(rc.User.UID), int64(rc.User.GID)
+	c := k8sContainer{
+		Name:       serviceName(rc.Image),
+		Image:      rc.Image,
+		Command:    rc.Args,
+		WorkingDir: rc.Cwd,
+		Tty:        rc.Tty,
+		Stdin:      rc.Tty,
+		SecurityContext: k8sSecurityContext{
+			RunAsUser:              &uid,
+			RunAsGroup:             &gid,
+			ReadOnlyRootFilesystem: rc.ReadOnly,
+		},
+	}
+	for _, e := range rc.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		c.Env = append(c.Env, k8sEnvVar{Name: kv[0], Value: kv[1]})
+	}
+	if rc.NoNewPrivileges {
+		allow := false
+		c.SecurityContext.AllowPrivilegeEscalation = &allow
+	}
+	if len(rc.CapAdd) > 0 || len(rc.CapDrop) > 0 {
+		c.SecurityContext.Capabilities = &k8sCapabilities{Add: rc.CapAdd, Drop: rc.CapDrop}
+	}
+	if l := rc.SelinuxLabel; l != nil {
+		c.SecurityContext.SELinuxOptions = &k8sSELinuxOptions{User: l.User, Role: l.Role, Type: l.Type, Level: l.Level}
+	}
+	if p := rc.ApparmorProfile; p != "" {
+		c.SecurityContext.AppArmorProfile = kubernetesAppArmorProfile(p)
+	}
+	c.Resources = kubernetesResources(rc)
+
+	spec := k8sPodSpec{
+		Hostname:    rc.Hostname,
+		HostNetwork: rc.NetworkMode == "host",
+		HostPID:     rc.PidMode == "host",
+		HostIPC:     rc.IpcMode == "host",
+	}
+	// Pods always have a network, and share the UTS namespace of the host
+	// exactly when they share its network.
+	if rc.NetworkMode == "none" {
+		rc.unsupported("a network namespace without network")
+	}
+	if (rc.UTSMode == "host") != spec.HostNetwork {
+		rc.unsupported("UTS namespace mode %q with network mode %q", rc.UTSMode, rc.NetworkMode)
+	}
+	if rc.UsernsMode == "" {
+		rc.unsupported("a user namespace of its own")
+	}
+	if rc.Hostname != "" && dnsLabel(rc.Hostname) != rc.Hostname {
+		rc.unsupported("hostname %q, which is not a DNS label", rc.Hostname)
+		spec.Hostname = ""
+	}
+	pod := &k8sPodSecurityContext{SupplementalGroups: rc.User.AdditionalGids}
+	var keys []string
+	for key := range rc.Sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pod.Sysctls = append(pod.Sysctls, k8sSysctl{Name: key, Value: rc.Sysctls[key]})
+	}
+	if len(pod.SupplementalGroups) > 0 || len(pod.Sysctls) > 0 {
+		spec.SecurityContext = pod
+	}
+
+	// Kubernetes sizes /dev/shm with a memory backed volume.
+	mounts := rc.Mounts
+	if rc.ShmSize > 0 {
+		mounts = append(mounts[:len(mounts):len(mounts)], runtimeMount{
+			Type:    "tmpfs",
+			Target:  "/dev/shm",
+			Options: []string{fmt.Sprintf("size=%d", rc.ShmSize)},
+		})
+	}
+	names := make(map[string]bool)
+	for _, m := range mounts {
+		if m.Type == "volume" {
+			rc.unsupported("read-only image content on %s, which Kubernetes volumes are not filled with", m.Target)
+			continue
+		}
+		v := k8sVolume{Name: volumeName(m.Target, names)}
+		vm := k8sVolumeMount{Name: v.Name, MountPath: m.Target, ReadOnly: m.ReadOnly}
+		switch m.Type {
+		case "bind":
+			v.HostPath = &k8sHostPathInfo{Path: m.Source}
+			vm.MountPropagation = k8sPropagation[m.Propagation]
+			if vm.MountPropagation == "Bidirectional" {
+				rc.unsupported("%s propagation on %s without a privileged container", m.Propagation, m.Target)
+				vm.MountPropagation = "HostToContainer"
+			}
+		case "tmpfs":
+			v.EmptyDir = &k8sEmptyDir{Medium: "Memory"}
+			for _, o := range m.Options {
+				switch {
+				case o == "ro":
+				case strings.HasPrefix(o, "size="):
+					if size, err := parseSize(o[len("size="):]); err == nil {
+						v.EmptyDir.SizeLimit = formatQuantity(size)
+					}
+				default:
+					rc.unsupported("tmpfs option %s on %s", o, m.Target)
+				}
+			}
+		}
+		spec.Volumes = append(spec.Volumes, v)
+		c.VolumeMounts = append(c.VolumeMounts, vm)
+	}
+
+	for _, u := range rc.Ulimits {
+		rc.unsupported("ulimit %s=%d:%d", u.Name, u.Soft, u.Hard)
+	}
+	for _, d := range rc.Devices {
+		rc.unsupported("device %s", d.PathOnHost)
+	}
+	for _, r := range rc.DeviceCgroupRules {
+		rc.unsupported("device rule %s", r)
+	}
+	spec.Containers = []k8sContainer{c}
+	return spec
+}
+
+// kubernetesResources maps the memory and CPU settings of rc to container
+// limits and requests. CPU shares become a request and a CFS quota a limit,
+// both in millicores.
+func kubernetesResources(rc *runtimeConfig) *k8sResources {
+	r := &k8sResources{Limits: map[string]string{}, Requests: map[string]string{}}
+	if rc.Memory > 0 {
+		r.Limits["memory"] = formatQuantity(rc.Memory)
+	}
+	if rc.MemoryReservation > 0 {
+		r.Requests["memory"] = formatQuantity(rc.MemoryReservation)
+	}
+	if rc.CPUQuota > 0 {
+		period := rc.CPUPeriod
+		if period == 0 {
+			period = 100000
+		}
+		r.Limits["cpu"] = fmt.Sprintf("%dm", rc.CPUQuota*1000/period)
+	}
+	if rc.CPUShares > 0 {
+		r.Requests["cpu"] = fmt.Sprintf("%dm", rc.CPUShares*1000/1024)
+	}
+	if rc.MemorySwap != 0 {
+		rc.unsupported("memory swap limit %d", rc.MemorySwap)
+	}
+	if rc.CpusetCpus != "" {
+		rc.unsupported("cpuset cpus %s", rc.CpusetCpus)
+	}
+	if rc.CpusetMems != "" {
+		rc.unsupported("cpuset mems %s", rc.CpusetMems)
+	}
+	if rc.PidsLimit != 0 {
+		rc.unsupported("pids limit %d", rc.PidsLimit)
+	}
+	if rc.KernelMemory != 0 {
+		rc.unsupported("kernel memory limit %d", rc.KernelMemory)
+	}
+	if rc.MemorySwappiness != nil {
+		rc.unsupported("memory swappiness %d", *rc.MemorySwappiness)
+	}
+	if rc.OomKillDisable || rc.OomScoreAdj != 0 {
+		rc.unsupported("OOM killer settings")
+	}
+	if rc.CPURealtimeRuntime != 0 || rc.CPURealtimePeriod != 0 {
+		rc.unsupported("realtime CPU scheduling limits")
+	}
+	if rc.BlkioWeight != 0 || len(rc.BlkioWeightDevice) > 0 || len(rc.BlkioDeviceReadBps) > 0 ||
+		len(rc.BlkioDeviceWriteBps) > 0 || len(rc.BlkioDeviceReadIOps) > 0 || len(rc.BlkioDeviceWriteIOps) > 0 {
+		rc.unsupported("block IO weights and limits")
+	}
+	if len(r.Limits) == 0 && len(r.Requests) == 0 {
+		return nil
+	}
+	return r
+}
+
+// formatQuantity writes a number of bytes as a Kubernetes quantity, with a
+// binary suffix when it divides evenly.
+func formatQuantity(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"Gi", 1 << 30}, {"Mi", 1 << 20}, {"Ki", 1 << 10}} {
+		if n >= unit.size && n%unit.size == 0 {
+			return fmt.Sprintf("%d%s", n/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprint(n)
+}
+
+// volumeName derives a unique volume name from a mount destination.
+func volumeName(target string, used map[string]bool) string {
+	base := dnsLabel(target)
+	if base == "" {
+		base = "volume"
+	}
+	name := base
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	used[name] = true
+	return name
+}
+
+// kubernetesAppArmorProfile maps an AppArmor profile name. Docker's
+// default profile is the default of the container runtime; any other
+// profile must be loaded on the node.
+func kubernetesAppArmorProfile(name string) *k8sAppArmorProfile {
+	switch name {
+	case "unconfined":
+		return &k8sAppArmorProfile{Type: "Unconfined"}
+	case "docker-default", "runtime/default":
+		return &k8sAppArmorProfile{Type: "RuntimeDefault"}
+	}
+	return &k8sAppArmorProfile{Type: "Localhost", LocalhostProfile: strings.TrimPrefix(name, "localhost/")}
+}
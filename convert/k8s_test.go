@@ -0,0 +1,250 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestNewKubernetesPodSpec(t *testing.T) {
+	uid, gid, noEscalation := int64(1000), int64(100), false
+	root := int64(0)
+	tests := []struct {
+		name        string
+		rc          runtimeConfig
+		want        k8sPodSpec
+		unsupported []string
+	}{
+		{
+			name: "process",
+			rc: runtimeConfig{
+				Image:           "cts/app:1.0",
+				Args:            []string{"/bin/app", "-v"},
+				Env:             []string{"PATH=/bin", "EMPTY=", "BARE"},
+				Cwd:             "/srv",
+				User:            specs.User{UID: 1000, GID: 100, AdditionalGids: []uint32{10}},
+				Hostname:        "app-1",
+				Tty:             true,
+				ReadOnly:        true,
+				UsernsMode:      "host",
+				CapAdd:          []string{"NET_ADMIN"},
+				NoNewPrivileges: true,
+				SelinuxLabel:    &selinuxLabel{User: "system_u", Role: "system_r", Type: "container_t", Level: "s0:c1,c2"},
+				ApparmorProfile: "localhost/app",
+				Sysctls:         map[string]string{"net.ipv4.ip_forward": "1", "kernel.shm_rmid_forced": "1"},
+			},
+			want: k8sPodSpec{
+				Hostname: "app-1",
+				SecurityContext: &k8sPodSecurityContext{
+					SupplementalGroups: []uint32{10},
+					Sysctls: []k8sSysctl{
+						{Name: "kernel.shm_rmid_forced", Value: "1"},
+						{Name: "net.ipv4.ip_forward", Value: "1"},
+					},
+				},
+				Containers: []k8sContainer{{
+					Name:       "app",
+					Image:      "cts/app:1.0",
+					Command:    []string{"/bin/app", "-v"},
+					Env:        []k8sEnvVar{{"PATH", "/bin"}, {"EMPTY", ""}, {"BARE", ""}},
+					WorkingDir: "/srv",
+					Tty:        true,
+					Stdin:      true,
+					SecurityContext: k8sSecurityContext{
+						RunAsUser:                &uid,
+						RunAsGroup:               &gid,
+						AllowPrivilegeEscalation: &noEscalation,
+						ReadOnlyRootFilesystem:   true,
+						Capabilities:             &k8sCapabilities{Add: []string{"NET_ADMIN"}},
+						SELinuxOptions:           &k8sSELinuxOptions{User: "system_u", Role: "system_r", Type: "container_t", Level: "s0:c1,c2"},
+						AppArmorProfile:          &k8sAppArmorProfile{Type: "Localhost", LocalhostProfile: "app"},
+					},
+				}},
+			},
+		},
+		{
+			name: "mounts",
+			rc: runtimeConfig{
+				Image:      "cts/app:1.0",
+				UsernsMode: "host",
+				Mounts: []runtimeMount{
+					{Type: "bind", Source: "/srv/data", Target: "/data", ReadOnly: true, Propagation: "rslave"},
+					{Type: "bind", Source: "/mnt", Target: "/mnt", Propagation: "rshared"},
+					{Type: "tmpfs", Target: "/tmp", Options: []string{"ro", "size=64m", "mode=1777"}},
+					{Type: "tmpfs", Target: "/_tmp"},
+					{Type: "volume", Target: "/var/lib/app"},
+				},
+				ShmSize: 1 << 30,
+			},
+			want: k8sPodSpec{
+				Containers: []k8sContainer{{
+					Name:            "app",
+					Image:           "cts/app:1.0",
+					SecurityContext: k8sSecurityContext{RunAsUser: &root, RunAsGroup: &root},
+					VolumeMounts: []k8sVolumeMount{
+						{Name: "data", MountPath: "/data", ReadOnly: true, MountPropagation: "HostToContainer"},
+						{Name: "mnt", MountPath: "/mnt", MountPropagation: "HostToContainer"},
+						{Name: "tmp", MountPath: "/tmp"},
+						{Name: "tmp-2", MountPath: "/_tmp"},
+						{Name: "dev-shm", MountPath: "/dev/shm"},
+					},
+				}},
+				Volumes: []k8sVolume{
+					{Name: "data", HostPath: &k8sHostPathInfo{Path: "/srv/data"}},
+					{Name: "mnt", HostPath: &k8sHostPathInfo{Path: "/mnt"}},
+					{Name: "tmp", EmptyDir: &k8sEmptyDir{Medium: "Memory", SizeLimit: "64Mi"}},
+					{Name: "tmp-2", EmptyDir: &k8sEmptyDir{Medium: "Memory"}},
+					{Name: "dev-shm", EmptyDir: &k8sEmptyDir{Medium: "Memory", SizeLimit: "1Gi"}},
+				},
+			},
+			unsupported: []string{
+				"rshared propagation on /mnt without a privileged container",
+				"tmpfs option mode=1777 on /tmp",
+				"read-only image content on /var/lib/app, which Kubernetes volumes are not filled with",
+			},
+		},
+		{
+			name: "namespaces and devices",
+			rc: runtimeConfig{
+				Image:             "cts/app:1.0",
+				NetworkMode:       "none",
+				PidMode:           "host",
+				IpcMode:           "host",
+				UTSMode:           "host",
+				Hostname:          "App_1",
+				Ulimits:           []ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+				Devices:           []deviceMapping{{"/dev/fuse", "/dev/fuse", "rwm"}},
+				DeviceCgroupRules: []string{"c 10:200 rwm"},
+			},
+			want: k8sPodSpec{
+				HostPID: true,
+				HostIPC: true,
+				Containers: []k8sContainer{{
+					Name:            "app",
+					Image:           "cts/app:1.0",
+					SecurityContext: k8sSecurityContext{RunAsUser: &root, RunAsGroup: &root},
+				}},
+			},
+			unsupported: []string{
+				"a network namespace without network",
+				`UTS namespace mode "host" with network mode "none"`,
+				"a user namespace of its own",
+				`hostname "App_1", which is not a DNS label`,
+				"ulimit nofile=1024:4096",
+				"device /dev/fuse",
+				"device rule c 10:200 rwm",
+			},
+		},
+	}
+	for _, tt := range tests {
+		rc := tt.rc
+		got := newKubernetesPodSpec(&rc)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+			t.Errorf("%s: got unsupported %q, want %q", tt.name, rc.Unsupported, tt.unsupported)
+		}
+	}
+}
+
+func TestNewKubernetesDeployment(t *testing.T) {
+	rc := &runtimeConfig{Image: "registry.example.com/team/web-app:2", UsernsMode: "host"}
+	d := newKubernetesDeployment(rc)
+	labels := map[string]string{"app": "web-app"}
+	if d.Kind != "Deployment" || d.APIVersion != "apps/v1" || d.Metadata.Name != "web-app" || d.Spec.Replicas != 1 {
+		t.Errorf("got %s %s %q with %d replicas", d.APIVersion, d.Kind, d.Metadata.Name, d.Spec.Replicas)
+	}
+	if !reflect.DeepEqual(d.Spec.Selector.MatchLabels, labels) || !reflect.DeepEqual(d.Spec.Template.Metadata.Labels, labels) {
+		t.Errorf("got selector %v and template labels %v, want %v", d.Spec.Selector.MatchLabels, d.Spec.Template.Metadata.Labels, labels)
+	}
+	if pod := newKubernetesPod(rc); !reflect.DeepEqual(pod.Spec, d.Spec.Template.Spec) {
+		t.Errorf("the Deployment template differs from the Pod: %+v, %+v", d.Spec.Template.Spec, pod.Spec)
+	}
+}
+
+func TestKubernetesResources(t *testing.T) {
+	swappiness := int64(10)
+	tests := []struct {
+		name        string
+		rc          runtimeConfig
+		want        *k8sResources
+		unsupported []string
+	}{
+		{name: "none"},
+		{
+			name: "limits and requests",
+			rc:   runtimeConfig{Memory: 512 << 20, MemoryReservation: 256 << 20, CPUQuota: 150000, CPUShares: 512},
+			want: &k8sResources{
+				Limits:   map[string]string{"memory": "512Mi", "cpu": "1500m"},
+				Requests: map[string]string{"memory": "256Mi", "cpu": "500m"},
+			},
+		},
+		{
+			name: "quota period",
+			rc:   runtimeConfig{CPUQuota: 25000, CPUPeriod: 50000},
+			want: &k8sResources{Limits: map[string]string{"cpu": "500m"}, Requests: map[string]string{}},
+		},
+		{
+			name: "unsupported",
+			rc: runtimeConfig{
+				MemorySwap:         -1,
+				CpusetCpus:         "0",
+				PidsLimit:          10,
+				MemorySwappiness:   &swappiness,
+				OomScoreAdj:        100,
+				CPURealtimePeriod:  1000,
+				BlkioDeviceReadBps: []throttleDevice{{Path: "/dev/sda", Rate: 1}},
+			},
+			unsupported: []string{
+				"memory swap limit -1",
+				"cpuset cpus 0",
+				"pids limit 10",
+				"memory swappiness 10",
+				"OOM killer settings",
+				"realtime CPU scheduling limits",
+				"block IO weights and limits",
+			},
+		},
+	}
+	for _, tt := range tests {
+		rc := tt.rc
+		if got := kubernetesResources(&rc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+			t.Errorf("%s: got unsupported %q, want %q", tt.name, rc.Unsupported, tt.unsupported)
+		}
+	}
+}
+
+func TestFormatQuantity(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:             "0",
+		1000:          "1000",
+		1 << 10:       "1Ki",
+		1536 << 10:    "1536Ki",
+		64 << 20:      "64Mi",
+		2 << 30:       "2Gi",
+		(1 << 30) + 1: "1073741825",
+	} {
+		if got := formatQuantity(n); got != want {
+			t.Errorf("formatQuantity(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestKubernetesAppArmorProfile(t *testing.T) {
+	for name, want := range map[string]k8sAppArmorProfile{
+		"unconfined":      {Type: "Unconfined"},
+		"docker-default":  {Type: "RuntimeDefault"},
+		"runtime/default": {Type: "RuntimeDefault"},
+		"localhost/nginx": {Type: "Localhost", LocalhostProfile: "nginx"},
+		"custom-profile":  {Type: "Localhost", LocalhostProfile: "custom-profile"},
+	} {
+		if got := kubernetesAppArmorProfile(name); *got != want {
+			t.Errorf("kubernetesAppArmorProfile(%q) = %+v, want %+v", name, *got, want)
+		}
+	}
+}
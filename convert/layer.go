@@ -0,0 +1,502 @@
+package convert
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// layerBlob describes a compressed layer written to a blob store.
+type layerBlob struct {
+	descriptor
+	// DiffID is the digest of the uncompressed tar stream.
+	DiffID string
+}
+
+// inode identifies a file on the host so that hard links can be kept.
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// archiver turns a rootfs, either a directory or the rootfs entries of a
+// bundle archive, into a layer tar stream.
+type archiver struct {
+	root    string
+	archive *bundleArchive
+	ignore  *ignoreMatcher
+	uidMap  idMap
+	gidMap  idMap
+	policy  *rootfsPolicy
+
+	// skipped counts the files left out by ignore.
+	skipped ignoreStats
+	// excludedDirs holds the excluded directories a ! line may re-include
+	// something below; pruned are those it cannot.
+	excludedDirs map[string]*tar.Header
+	pruned       map[string]bool
+	// unmapped counts the files whose owner is outside uidMap or gidMap.
+	unmapped int
+}
+
+func newArchiver(bundle string, opts Options) (*archiver, error) {
+	ignore, err := loadIgnore(bundle, opts.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	a := &archiver{
+		root:    filepath.Join(bundle, RootfsDir),
+		archive: opts.archive,
+		ignore:  ignore,
+		uidMap:  opts.UIDMappings,
+		gidMap:  opts.GIDMappings,
+		policy:  &rootfsPolicy{strict: opts.StrictRootfs},
+	}
+	if spec := getConfigSpec(bundle); spec != nil {
+		if a.uidMap == nil {
+			a.uidMap = spec.Linux.UIDMappings
+		}
+		if a.gidMap == nil {
+			a.gidMap = spec.Linux.GIDMappings
+		}
+	}
+	return a, nil
+}
+
+// writeLayer archives the rootfs as a layer tar stream.
+func (a *archiver) writeLayer(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	if err := a.writeEntries(tw, ""); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeEntries writes the entries of the rootfs to tw, with prefix in
+// front of their names.
+func (a *archiver) writeEntries(tw *tar.Writer, prefix string) error {
+	a.skipped = ignoreStats{}
+	a.unmapped = 0
+	a.policy.issues = nil
+
+	err := a.walk(func(hdr *tar.Header, body io.Reader) error {
+		return a.add(tw, prefix, hdr, body)
+	})
+	if err != nil {
+		return err
+	}
+
+	if a.ignore != nil {
+		logrus.Infof("Excluded %d files (%d bytes) and %d directory trees from the rootfs.", a.skipped.Files, a.skipped.Bytes, a.skipped.Dirs)
+	}
+	if a.unmapped > 0 {
+		logrus.Warnf("%d files are owned by IDs outside the uid/gid mappings and keep their host owner.", a.unmapped)
+	}
+	return a.policy.err()
+}
+
+// skip reports whether hdr is excluded by the ignore file. An excluded
+// directory is kept aside in case a ! line re-includes something below it;
+// prune reports that nothing below it can be, so the walk leaves it out.
+func (a *archiver) skip(hdr *tar.Header) (skip, prune bool) {
+	name := strings.TrimSuffix(hdr.Name, "/")
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if a.pruned[dir] {
+			if hdr.Typeflag != tar.TypeDir {
+				a.skipped.Files++
+				a.skipped.Bytes += hdr.Size
+			}
+			return true, true
+		}
+	}
+	if !a.ignore.excluded(name) {
+		return false, false
+	}
+	if hdr.Typeflag != tar.TypeDir {
+		a.skipped.Files++
+		a.skipped.Bytes += hdr.Size
+		return true, false
+	}
+	if !a.ignore.mayReinclude(name) {
+		a.skipped.Dirs++
+		a.pruned[name] = true
+		return true, true
+	}
+	dir := *hdr
+	a.excludedDirs[name] = &dir
+	return true, false
+}
+
+// addParents passes the excluded directories above a re-included entry to
+// fn first, so that the layer has entries for them.
+func (a *archiver) addParents(hdr *tar.Header, fn entryFunc) error {
+	if len(a.excludedDirs) == 0 {
+		return nil
+	}
+	var parents []string
+	for dir := path.Dir(strings.TrimSuffix(hdr.Name, "/")); dir != "."; dir = path.Dir(dir) {
+		parents = append(parents, dir)
+	}
+	for i := len(parents) - 1; i >= 0; i-- {
+		if dir, ok := a.excludedDirs[parents[i]]; ok {
+			delete(a.excludedDirs, parents[i])
+			if err := fn(dir, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add writes hdr, moved below prefix, and, for regular files, the content
+// read from body.
+func (a *archiver) add(tw *tar.Writer, prefix string, hdr *tar.Header, body io.Reader) error {
+	hdr.Uname, hdr.Gname = "", ""
+	a.mapOwner(hdr)
+	if err := a.policy.check(hdr); err != nil {
+		return err
+	}
+	hdr.Name = prefix + hdr.Name
+	if hdr.Typeflag == tar.TypeLink {
+		hdr.Linkname = prefix + hdr.Linkname
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return nil
+	}
+	_, err := io.Copy(tw, body)
+	return err
+}
+
+// entryFunc is called for every rootfs entry that is not excluded. body
+// holds the content of regular files.
+type entryFunc func(hdr *tar.Header, body io.Reader) error
+
+// walk calls fn for the entries of the rootfs, in archive order.
+func (a *archiver) walk(fn entryFunc) error {
+	a.excludedDirs = make(map[string]*tar.Header)
+	a.pruned = make(map[string]bool)
+	if a.archive != nil {
+		return a.walkArchive(fn)
+	}
+	return a.walkDir(fn)
+}
+
+// walkDir walks the rootfs directory.
+func (a *archiver) walkDir(fn entryFunc) error {
+	links := make(map[inode]string)
+
+	walkRootfs := func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rpath, err := filepath.Rel(a.root, fpath)
+		if err != nil {
+			return err
+		}
+		if rpath == "." || fi.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+		rpath = filepath.ToSlash(rpath)
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(fpath); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return fmt.Errorf("%s: %v", rpath, err)
+		}
+		hdr.Name = rpath
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if skip, prune := a.skip(hdr); skip {
+			if prune && fi.IsDir() {
+				if err := a.countPruned(fpath); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := a.addParents(hdr, fn); err != nil {
+			return err
+		}
+
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && fi.Mode().IsRegular() && st.Nlink > 1 {
+			id := inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+			if target, seen := links[id]; seen {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				hdr.Size = 0
+			} else {
+				links[id] = rpath
+			}
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			return fn(hdr, nil)
+		}
+		f, err := os.Open(fpath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return fn(hdr, f)
+	}
+	return filepath.Walk(a.root, walkRootfs)
+}
+
+// countPruned counts the files below the pruned directory dir as skipped.
+// Only their metadata is read.
+func (a *archiver) countPruned(dir string) error {
+	return filepath.Walk(dir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fpath == dir || fi.IsDir() || fi.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+		if fi.Mode().IsRegular() {
+			a.skipped.Bytes += fi.Size()
+		}
+		a.skipped.Files++
+		return nil
+	})
+}
+
+// walkArchive walks the rootfs entries of a bundle archive.
+func (a *archiver) walkArchive(fn entryFunc) error {
+	tr, closer, err := a.archive.open()
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rpath, ok, err := a.archive.rootfsName(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		hdr.Name = rpath
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			target, ok, err := a.archive.rootfsName(hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("hard link %s points outside the rootfs", rpath)
+			}
+			hdr.Linkname = target
+		}
+		if skip, _ := a.skip(hdr); skip {
+			continue
+		}
+		if err := a.addParents(hdr, fn); err != nil {
+			return err
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// mapOwner shifts the owner of hdr from host IDs to container IDs.
+func (a *archiver) mapOwner(hdr *tar.Header) {
+	mapped := true
+	if len(a.uidMap) > 0 {
+		uid, ok := a.uidMap.toContainer(hdr.Uid)
+		hdr.Uid, mapped = uid, mapped && ok
+	}
+	if len(a.gidMap) > 0 {
+		gid, ok := a.gidMap.toContainer(hdr.Gid)
+		hdr.Gid, mapped = gid, mapped && ok
+	}
+	if !mapped {
+		logrus.Debugf("%s: owner %d:%d is not covered by the id mappings", hdr.Name, hdr.Uid, hdr.Gid)
+		a.unmapped++
+	}
+}
+
+// copyRootfs recreates the archived rootfs under dst, so that the docker
+// build context gets exactly what a written layer would contain.
+func (a *archiver) copyRootfs(dst string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(a.writeLayer(pw))
+	}()
+	err := unpackLayer(pr, dst)
+	pr.CloseWithError(err)
+	return err
+}
+
+// unpackLayer extracts a layer tar stream below dst. Symlinks are never
+// followed while writing, ownership is not restored, and device nodes are
+// skipped when they cannot be created. Directory modes are set once all
+// entries are written, so read-only directories can still be filled.
+func unpackLayer(r io.Reader, dst string) error {
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		target, err := securePath(dst, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+			dirs = append(dirs, dirMode{target, mode})
+		case tar.TypeReg, tar.TypeRegA:
+			var f *os.File
+			f, err = os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err == nil {
+				err = os.Chmod(target, mode)
+			}
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, target)
+		case tar.TypeLink:
+			var source string
+			if source, err = securePath(dst, hdr.Linkname); err == nil {
+				err = os.Link(source, target)
+			}
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := mknod(target, hdr); err != nil {
+				logrus.Debugf("Skip special file %s: %v", hdr.Name, err)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mknod(path string, hdr *tar.Header) error {
+	mode := uint32(hdr.Mode & 07777)
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		mode |= syscall.S_IFCHR
+	case tar.TypeBlock:
+		mode |= syscall.S_IFBLK
+	case tar.TypeFifo:
+		mode |= syscall.S_IFIFO
+	}
+	dev := (hdr.Devminor & 0xff) | (hdr.Devmajor&0xfff)<<8 | (hdr.Devminor&^0xff)<<12
+	return syscall.Mknod(path, mode, int(dev))
+}
+
+// writeLayerBlob archives the rootfs, compresses it and stores the result
+// in dir under its digest. The uncompressed diffID is computed on the way.
+func writeLayerBlob(dir string, a *archiver, format ImageFormat, c Compression) (*layerBlob, error) {
+	mediaType, err := layerMediaType(format, c)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempFile(dir, "layer-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	blobHash := sha256.New()
+	counter := &countWriter{}
+	zw, err := newCompressor(io.MultiWriter(tmp, blobHash, counter), c)
+	if err != nil {
+		return nil, err
+	}
+	diffHash := sha256.New()
+	if err := a.writeLayer(io.MultiWriter(zw, diffHash)); err != nil {
+		zw.Close()
+		return nil, fmt.Errorf("archiving rootfs: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compressing layer: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return nil, err
+	}
+
+	digest := fmt.Sprintf("sha256:%x", blobHash.Sum(nil))
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, fmt.Sprintf("%x", blobHash.Sum(nil)))); err != nil {
+		return nil, err
+	}
+	return &layerBlob{
+		descriptor: descriptor{
+			MediaType: mediaType,
+			Digest:    digest,
+			Size:      counter.n,
+		},
+		DiffID: fmt.Sprintf("sha256:%x", diffHash.Sum(nil)),
+	}, nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,179 @@
+package convert
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestBundle creates a bundle directory whose rootfs holds files, with
+// the given content, and an exclude file if ignore is not empty.
+func writeTestBundle(t *testing.T, files map[string]string, ignore string) string {
+	bundle, err := ioutil.TempDir("", "oci2docker-layer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(bundle, RootfsDir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ignore != "" {
+		if err := ioutil.WriteFile(filepath.Join(bundle, IgnoreFile), []byte(ignore), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bundle
+}
+
+func TestWriteLayerIgnore(t *testing.T) {
+	files := map[string]string{
+		"bin/sh":             "shell",
+		"app.log":            "log",
+		"cache/big/file":     "cached",
+		"tmp/scratch":        "scratch",
+		"tmp/keep/file":      "kept",
+		"tmp/keep/other":     "other",
+		"var/lib/cache/data": "data",
+	}
+	tests := []struct {
+		name   string
+		ignore string
+		want   []string
+		stats  ignoreStats
+	}{
+		{
+			name: "no ignore file",
+			want: []string{
+				"app.log", "bin/", "bin/sh", "cache/", "cache/big/", "cache/big/file",
+				"tmp/", "tmp/keep/", "tmp/keep/file", "tmp/keep/other", "tmp/scratch",
+				"var/", "var/lib/", "var/lib/cache/", "var/lib/cache/data",
+			},
+		},
+		{
+			name:   "pruned trees",
+			ignore: "*.log\n**/cache\n",
+			want:   []string{"bin/", "bin/sh", "tmp/", "tmp/keep/", "tmp/keep/file", "tmp/keep/other", "tmp/scratch", "var/", "var/lib/"},
+			stats:  ignoreStats{Files: 3, Bytes: 13, Dirs: 2},
+		},
+		{
+			name:   "re-included file",
+			ignore: "tmp\n!tmp/keep/file\n",
+			want: []string{
+				"app.log", "bin/", "bin/sh", "cache/", "cache/big/", "cache/big/file",
+				"tmp/", "tmp/keep/", "tmp/keep/file",
+				"var/", "var/lib/", "var/lib/cache/", "var/lib/cache/data",
+			},
+			stats: ignoreStats{Files: 2, Bytes: 12},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := writeTestBundle(t, files, tt.ignore)
+			defer os.RemoveAll(bundle)
+
+			a, err := newArchiver(bundle, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := a.writeLayer(&buf); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			tr := tar.NewReader(&buf)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, hdr.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got entries %v, want %v", names, tt.want)
+			}
+			if a.skipped != tt.stats {
+				t.Errorf("got stats %+v, want %+v", a.skipped, tt.stats)
+			}
+		})
+	}
+}
+
+func TestWriteLayerIgnoreArchive(t *testing.T) {
+	file := writeTestArchive(t, []string{
+		"config.json", "rootfs/", "rootfs/bin/", "rootfs/bin/sh",
+		"rootfs/cache/", "rootfs/cache/big/", "rootfs/cache/big/file", "rootfs/cache/small",
+	}, false)
+	defer os.Remove(file)
+	b, err := openBundleArchive(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if err := ioutil.WriteFile(filepath.Join(b.dir, IgnoreFile), []byte("cache\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newArchiver(b.dir, Options{archive: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.writeLayer(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	want := ignoreStats{Files: 2, Bytes: int64(len("rootfs/cache/big/file") + len("rootfs/cache/small")), Dirs: 1}
+	if a.skipped != want {
+		t.Errorf("got stats %+v, want %+v", a.skipped, want)
+	}
+}
+
+func TestUnpackLayerReadOnlyDirs(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "ro/", Mode: 0555, Typeflag: tar.TypeDir},
+		{Name: "ro/sub/", Mode: 0500, Typeflag: tar.TypeDir},
+		{Name: "ro/sub/file", Mode: 0644, Typeflag: tar.TypeReg, Size: 4},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			io.WriteString(tw, "data")
+		}
+	}
+	tw.Close()
+
+	dst, err := ioutil.TempDir("", "oci2docker-unpack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	defer os.Chmod(filepath.Join(dst, "ro"), 0755)
+	defer os.Chmod(filepath.Join(dst, "ro/sub"), 0755)
+
+	if err := unpackLayer(&buf, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"ro": 0555, "ro/sub": 0500, "ro/sub/file": 0644} {
+		fi, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != want {
+			t.Errorf("%s: got mode %v, want %v", name, fi.Mode().Perm(), want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package convert
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+func isIndexMediaType(mediaType string) bool {
+	return mediaType == mediaTypeDockerManifestList || mediaType == mediaTypeOCIIndex
+}
+
+// platformImage is the image converted from one bundle of a multi-platform
+// conversion.
+type platformImage struct {
+	bundle  string
+	dir     string
+	archive *bundleArchive
+	desc    descriptor
+	config  *imageConfig
+}
+
+func (p platformImage) platform() string {
+	return p.config.OS + "/" + p.config.Architecture
+}
+
+// RunOCI2DockerMultiArch converts several bundles of the same application,
+// one per platform, into a single Docker manifest list or OCI image index.
+// Every bundle must declare its platform.os and platform.arch.
+func RunOCI2DockerMultiArch(paths []string, opts Options) {
+	setLogLevel(opts.Debug)
+
+	if opts.Output == "" && len(opts.Push) == 0 {
+		logrus.Infof("Converting several bundles requires --output or --push.")
+		return
+	}
+	cleanup, err := tempOutput(&opts)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	defer cleanup()
+
+	desc, err := writeMultiArchImage(paths, &opts)
+	if err != nil {
+		logrus.Infof("Write image failed: %v", err)
+		return
+	}
+	publishImage(desc, opts)
+}
+
+// writeMultiArchImage writes the image index of the bundles at paths. The
+// image names of opts get the default tag of the first bundle. Bundles
+// that start differently are reported before anything is converted.
+func writeMultiArchImage(paths []string, opts *Options) (descriptor, error) {
+	stdin := 0
+	for _, path := range paths {
+		if path == "-" {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		return descriptor{}, fmt.Errorf("only one bundle can be read from stdin")
+	}
+
+	images := make([]platformImage, len(paths))
+	seen := make(map[string]string)
+	for i, path := range paths {
+		dir, archive, err := openBundle(path)
+		if err != nil {
+			return descriptor{}, err
+		}
+		if archive != nil {
+			defer archive.Close()
+		}
+		spec := getConfigSpec(dir)
+		if spec == nil {
+			return descriptor{}, ErrNoConfig
+		}
+		if spec.Platform.OS == "" || spec.Platform.Arch == "" {
+			return descriptor{}, fmt.Errorf("%s: config.json must set platform.os and platform.arch", path)
+		}
+		p := spec.Platform.OS + "/" + spec.Platform.Arch
+		if other, ok := seen[p]; ok {
+			return descriptor{}, fmt.Errorf("bundles %s and %s are both for %s", other, path, p)
+		}
+		seen[p] = path
+		config, err := newImageConfig(dir, opts.Ports)
+		if err != nil {
+			return descriptor{}, fmt.Errorf("%s: %v", path, err)
+		}
+		images[i] = platformImage{bundle: path, dir: dir, archive: archive, config: config}
+	}
+	for _, d := range checkDivergence(images) {
+		logrus.Warnf("Bundles diverge on %s.", d)
+	}
+	if err := tagImageNames(images[0].dir, opts); err != nil {
+		return descriptor{}, err
+	}
+
+	layout, err := newImageLayout(opts.Output)
+	if err != nil {
+		return descriptor{}, fmt.Errorf("creating image layout: %v", err)
+	}
+	for i := range images {
+		img := &images[i]
+		o := *opts
+		o.archive = img.archive
+		if img.desc, img.config, err = writeImageManifest(layout, img.dir, o); err != nil {
+			return descriptor{}, fmt.Errorf("%s: %v", img.bundle, err)
+		}
+		logrus.Infof("Converted %s for %s.", img.bundle, img.platform())
+	}
+
+	index := imageIndex{SchemaVersion: 2, MediaType: mediaTypeDockerManifestList}
+	if opts.Format == FormatOCI {
+		index.MediaType = mediaTypeOCIIndex
+	}
+	for _, img := range images {
+		index.Manifests = append(index.Manifests, img.desc)
+	}
+	indexDesc, err := layout.putJSON(index.MediaType, index)
+	if err != nil {
+		return descriptor{}, err
+	}
+	if err := layout.writeIndex(namedDescriptors(indexDesc, opts.ImageNames)); err != nil {
+		return descriptor{}, err
+	}
+	return indexDesc, nil
+}
+
+// checkDivergence describes how the images of a multi-platform conversion
+// do not start the same way. Users pulling the image expect identical
+// behavior whatever their platform.
+func checkDivergence(images []platformImage) []string {
+	var diffs []string
+	if len(images) < 2 {
+		return nil
+	}
+	first := images[0]
+	for _, img := range images[1:] {
+		a, b := first.config.Config, img.config.Config
+		fields := []struct {
+			name string
+			a, b interface{}
+		}{
+			{"entrypoint", a.Entrypoint, b.Entrypoint},
+			{"cmd", a.Cmd, b.Cmd},
+			{"env", a.Env, b.Env},
+			{"working directory", a.WorkingDir, b.WorkingDir},
+			{"user", a.User, b.User},
+		}
+		for _, f := range fields {
+			if !reflect.DeepEqual(f.a, f.b) {
+				diffs = append(diffs, fmt.Sprintf("%s: %s has %s, %s has %s",
+					f.name, first.platform(), describeValue(f.a), img.platform(), describeValue(f.b)))
+			}
+		}
+	}
+	return diffs
+}
+
+func describeValue(v interface{}) string {
+	switch v := v.(type) {
+	case []string:
+		return "[" + strings.Join(v, " ") + "]"
+	case string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,180 @@
+package convert
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// writePlatformBundle writes a bundle for os/arch whose rootfs holds a
+// static binary /bin/app built for binArch, which the bundle runs with
+// env.
+func writePlatformBundle(t *testing.T, os_, arch, binArch string, env ...string) string {
+	bundle := writeTestBundle(t, map[string]string{
+		"bin/app": elfHead(elfTargets[binArch], elf.ET_EXEC, ""),
+	}, "")
+	if err := os.Chmod(filepath.Join(bundle, RootfsDir, "bin/app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	spec := specs.Spec{Version: "1.0.0"}
+	spec.Platform.OS, spec.Platform.Arch = os_, arch
+	spec.Root.Path = RootfsDir
+	spec.Process.Args = []string{"/bin/app"}
+	spec.Process.Cwd = "/"
+	spec.Process.Env = env
+	writeTestSpec(t, bundle, &spec)
+	return bundle
+}
+
+func TestWriteMultiArchImage(t *testing.T) {
+	amd64 := writePlatformBundle(t, "linux", "amd64", "amd64")
+	arm64 := writePlatformBundle(t, "linux", "arm64", "arm64")
+	arm64Env := writePlatformBundle(t, "linux", "arm64", "arm64", "DEBUG=1")
+	arm64Bad := writePlatformBundle(t, "linux", "arm64", "amd64")
+	noPlatform := writePlatformBundle(t, "", "", "amd64")
+	for _, b := range []string{amd64, arm64, arm64Env, arm64Bad, noPlatform} {
+		defer os.RemoveAll(b)
+	}
+
+	tests := []struct {
+		name      string
+		paths     []string
+		format    ImageFormat
+		mediaType string
+		platforms []string
+		err       string
+	}{
+		{
+			name:      "docker manifest list",
+			paths:     []string{amd64, arm64},
+			mediaType: mediaTypeDockerManifestList,
+			platforms: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			name:      "oci index",
+			paths:     []string{arm64, amd64},
+			format:    FormatOCI,
+			mediaType: mediaTypeOCIIndex,
+			platforms: []string{"linux/arm64", "linux/amd64"},
+		},
+		{
+			name:      "divergence",
+			paths:     []string{amd64, arm64Env},
+			mediaType: mediaTypeDockerManifestList,
+			platforms: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			name:  "same platform",
+			paths: []string{arm64, arm64Env},
+			err:   "are both for linux/arm64",
+		},
+		{
+			name:  "no platform",
+			paths: []string{amd64, noPlatform},
+			err:   noPlatform + ": config.json must set platform.os and platform.arch",
+		},
+		{
+			name:  "wrong binaries",
+			paths: []string{amd64, arm64Bad},
+			err:   arm64Bad + ": platform.arch is arm64",
+		},
+		{
+			name:  "several stdin bundles",
+			paths: []string{"-", amd64, "-"},
+			err:   "only one bundle can be read from stdin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ioutil.TempDir("", "oci2docker-multiarch")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(out)
+			format := tt.format
+			if format == "" {
+				format = FormatDocker
+			}
+			opts := &Options{
+				Output:      out,
+				Format:      format,
+				Compression: CompressionNone,
+				ImageNames:  []string{"cts/app"},
+			}
+
+			desc, err := writeMultiArchImage(tt.paths, opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				if _, err := os.Stat(filepath.Join(out, "index.json")); err == nil {
+					t.Errorf("a failed conversion wrote index.json")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desc.MediaType != tt.mediaType {
+				t.Errorf("got media type %s, want %s", desc.MediaType, tt.mediaType)
+			}
+			if !reflect.DeepEqual(opts.ImageNames, []string{"cts/app:1.0.0"}) {
+				t.Errorf("got image names %q", opts.ImageNames)
+			}
+			data, err := ioutil.ReadFile((&imageLayout{dir: out}).blobPath(desc.Digest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var index imageIndex
+			if err := json.Unmarshal(data, &index); err != nil {
+				t.Fatal(err)
+			}
+			var platforms []string
+			for _, m := range index.Manifests {
+				platforms = append(platforms, m.Platform.OS+"/"+m.Platform.Architecture)
+			}
+			if !reflect.DeepEqual(platforms, tt.platforms) {
+				t.Errorf("got platforms %q, want %q", platforms, tt.platforms)
+			}
+		})
+	}
+}
+
+func TestCheckDivergence(t *testing.T) {
+	image := func(arch string, c containerConfig) platformImage {
+		return platformImage{config: &imageConfig{OS: "linux", Architecture: arch, Config: c}}
+	}
+	base := containerConfig{Entrypoint: []string{"/bin/app"}, Env: []string{"A=1"}, WorkingDir: "/", User: "0:0"}
+	other := base
+	other.Entrypoint, other.WorkingDir, other.User = []string{"/bin/app2"}, "/srv", "1:1"
+
+	tests := []struct {
+		name   string
+		images []platformImage
+		want   []string
+	}{
+		{name: "single", images: []platformImage{image("amd64", base)}},
+		{name: "same", images: []platformImage{image("amd64", base), image("arm64", base), image("s390x", base)}},
+		{
+			name:   "different",
+			images: []platformImage{image("amd64", base), image("arm64", other)},
+			want: []string{
+				"entrypoint: linux/amd64 has [/bin/app], linux/arm64 has [/bin/app2]",
+				`working directory: linux/amd64 has "/", linux/arm64 has "/srv"`,
+				`user: linux/amd64 has "0:0", linux/arm64 has "1:1"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := checkDivergence(tt.images); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// cgroupNamespace is the cgroup namespace type, which the vendored specs
+// predate.
+const cgroupNamespace specs.NamespaceType = "cgroup"
+
+// nsFiles are the names of the namespace files in /proc/<pid>/ns.
+var nsFiles = map[specs.NamespaceType]string{
+	specs.PIDNamespace:     "pid",
+	specs.NetworkNamespace: "net",
+	specs.MountNamespace:   "mnt",
+	specs.IPCNamespace:     "ipc",
+	specs.UTSNamespace:     "uts",
+	specs.UserNamespace:    "user",
+	cgroupNamespace:        "cgroup",
+}
+
+// mapNamespaces maps linux.namespaces to the namespace modes of Docker. A
+// namespace the bundle does not ask for is shared with the host; one it
+// asks for is a new, private one. Docker can only join the namespaces of
+// the host or of other containers, so a namespace path of the host is
+// shared with the host, and any other is reported and replaced by a new
+// namespace.
+func (rc *runtimeConfig) mapNamespaces(spec *specs.Spec) error {
+	namespaces := make(map[specs.NamespaceType]specs.Namespace)
+	for _, ns := range spec.Linux.Namespaces {
+		if _, ok := nsFiles[ns.Type]; !ok {
+			return fmt.Errorf("unknown namespace type %q", ns.Type)
+		}
+		if _, ok := namespaces[ns.Type]; ok {
+			return fmt.Errorf("namespace %s is listed more than once", ns.Type)
+		}
+		namespaces[ns.Type] = ns
+	}
+	mode := func(typ specs.NamespaceType) string {
+		ns, ok := namespaces[typ]
+		if !ok {
+			return "host"
+		}
+		if ns.Path == "" {
+			return ""
+		}
+		if isHostNamespace(typ, ns.Path) {
+			return "host"
+		}
+		rc.unsupported("joining the %s namespace %s, which is not the host's; the container gets a new one", typ, ns.Path)
+		return ""
+	}
+
+	if mode(specs.MountNamespace) == "host" {
+		return fmt.Errorf("a container without its own mount namespace cannot be created by Docker")
+	}
+
+	rc.NetworkMode = mode(specs.NetworkNamespace)
+	if _, ok := namespaces[specs.NetworkNamespace]; ok && rc.NetworkMode == "" {
+		// A new network namespace only has a loopback interface.
+		rc.NetworkMode = "none"
+	}
+	rc.PidMode = mode(specs.PIDNamespace)
+	rc.IpcMode = mode(specs.IPCNamespace)
+	rc.UTSMode = mode(specs.UTSNamespace)
+	rc.CgroupnsMode = mode(cgroupNamespace)
+	if rc.CgroupnsMode == "" {
+		rc.CgroupnsMode = "private"
+	}
+
+	user, ok := namespaces[specs.UserNamespace]
+	switch {
+	case !ok:
+		rc.UsernsMode = "host"
+	case user.Path != "" && !isHostNamespace(specs.UserNamespace, user.Path):
+		rc.unsupported("joining the user namespace %s, which is not the host's; Docker only joins the user namespace of the host", user.Path)
+	case user.Path != "":
+		rc.UsernsMode = "host"
+	default:
+		rc.unsupported("a user namespace of its own, which Docker only sets up when the daemon remaps users")
+		if len(spec.Linux.UIDMappings) > 0 || len(spec.Linux.GIDMappings) > 0 {
+			rc.unsupported("the uid and gid mappings of the user namespace")
+		}
+	}
+
+	if rc.UTSMode == "host" && spec.Hostname != "" {
+		return fmt.Errorf("hostname %q needs a UTS namespace of its own", spec.Hostname)
+	}
+	if rc.IpcMode == "host" && rc.ShmSize > 0 {
+		rc.unsupported("the /dev/shm size with the IPC namespace of the host")
+		rc.ShmSize = 0
+	}
+	return nil
+}
+
+// isHostNamespace reports whether the namespace file at path is the
+// namespace of type typ of the host, that of process 1.
+func isHostNamespace(typ specs.NamespaceType, path string) bool {
+	if path == "/proc/1/ns/"+nsFiles[typ] {
+		return true
+	}
+	ns, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	host, err := os.Readlink("/proc/1/ns/" + nsFiles[typ])
+	return err == nil && ns == host
+}
@@ -0,0 +1,153 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// namespaceModes are the namespace modes of a runtimeConfig, in the order
+// network, pid, ipc, uts, user, cgroup.
+type namespaceModes [6]string
+
+func TestMapNamespaces(t *testing.T) {
+	private := func(types ...specs.NamespaceType) []specs.Namespace {
+		var namespaces []specs.Namespace
+		for _, typ := range types {
+			namespaces = append(namespaces, specs.Namespace{Type: typ})
+		}
+		return namespaces
+	}
+	all := private(specs.MountNamespace, specs.NetworkNamespace, specs.PIDNamespace,
+		specs.IPCNamespace, specs.UTSNamespace, cgroupNamespace)
+
+	tests := []struct {
+		name        string
+		namespaces  []specs.Namespace
+		hostname    string
+		mappings    bool
+		shmSize     int64
+		want        namespaceModes
+		unsupported []string
+		err         string
+	}{
+		{
+			name:       "private",
+			namespaces: all,
+			hostname:   "box",
+			want:       namespaceModes{"none", "", "", "", "host", "private"},
+		},
+		{
+			name:       "mount only",
+			namespaces: private(specs.MountNamespace),
+			want:       namespaceModes{"host", "host", "host", "host", "host", "host"},
+		},
+		{
+			name: "host namespace files",
+			namespaces: []specs.Namespace{
+				{Type: specs.MountNamespace},
+				{Type: specs.NetworkNamespace, Path: "/proc/1/ns/net"},
+				{Type: specs.PIDNamespace, Path: "/proc/1/ns/pid"},
+				{Type: specs.UserNamespace, Path: "/proc/1/ns/user"},
+			},
+			want: namespaceModes{"host", "host", "host", "host", "host", "host"},
+		},
+		{
+			name:        "user namespace",
+			namespaces:  append(private(specs.UserNamespace), all...),
+			mappings:    true,
+			want:        namespaceModes{"none", "", "", "", "", "private"},
+			unsupported: []string{"a user namespace of its own, which Docker only sets up when the daemon remaps users", "the uid and gid mappings of the user namespace"},
+		},
+		{
+			name:        "shm size with host ipc",
+			namespaces:  private(specs.MountNamespace, specs.UTSNamespace),
+			shmSize:     128 << 20,
+			want:        namespaceModes{"host", "host", "host", "", "host", "host"},
+			unsupported: []string{"the /dev/shm size with the IPC namespace of the host"},
+		},
+		{
+			name:       "no mount namespace",
+			namespaces: private(specs.NetworkNamespace),
+			err:        "without its own mount namespace",
+		},
+		{
+			name:       "unknown type",
+			namespaces: private(specs.MountNamespace, "time"),
+			err:        `unknown namespace type "time"`,
+		},
+		{
+			name:       "listed twice",
+			namespaces: private(specs.MountNamespace, specs.PIDNamespace, specs.PIDNamespace),
+			err:        "namespace pid is listed more than once",
+		},
+		{
+			name: "namespace file",
+			namespaces: []specs.Namespace{
+				{Type: specs.MountNamespace},
+				{Type: specs.NetworkNamespace, Path: "/var/run/netns/test"},
+			},
+			want:        namespaceModes{"none", "host", "host", "host", "host", "host"},
+			unsupported: []string{"joining the network namespace /var/run/netns/test, which is not the host's; the container gets a new one"},
+		},
+		{
+			name: "mount namespace file",
+			namespaces: []specs.Namespace{
+				{Type: specs.MountNamespace, Path: "/proc/4242/ns/mnt"},
+				{Type: specs.PIDNamespace, Path: "/proc/4242/ns/pid"},
+			},
+			want: namespaceModes{"host", "", "host", "host", "host", "host"},
+			unsupported: []string{
+				"joining the mount namespace /proc/4242/ns/mnt, which is not the host's; the container gets a new one",
+				"joining the pid namespace /proc/4242/ns/pid, which is not the host's; the container gets a new one",
+			},
+		},
+		{
+			name: "user namespace file",
+			namespaces: []specs.Namespace{
+				{Type: specs.MountNamespace},
+				{Type: specs.UserNamespace, Path: "/var/run/userns/test"},
+			},
+			want:        namespaceModes{"host", "host", "host", "host", "", "host"},
+			unsupported: []string{"joining the user namespace /var/run/userns/test, which is not the host's; Docker only joins the user namespace of the host"},
+		},
+		{
+			name:       "hostname with host uts",
+			namespaces: private(specs.MountNamespace),
+			hostname:   "box",
+			err:        `hostname "box" needs a UTS namespace of its own`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &specs.Spec{Hostname: tt.hostname}
+			spec.Linux.Namespaces = tt.namespaces
+			if tt.mappings {
+				spec.Linux.UIDMappings = []specs.IDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}}
+			}
+			rc := &runtimeConfig{ShmSize: tt.shmSize}
+			err := rc.mapNamespaces(spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := namespaceModes{rc.NetworkMode, rc.PidMode, rc.IpcMode, rc.UTSMode, rc.UsernsMode, rc.CgroupnsMode}
+			if got != tt.want {
+				t.Errorf("got modes %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+				t.Errorf("got unsupported %q, want %q", rc.Unsupported, tt.unsupported)
+			}
+			if tt.shmSize > 0 && rc.IpcMode == "host" && rc.ShmSize != 0 {
+				t.Errorf("kept /dev/shm size %d with the host IPC namespace", rc.ShmSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// The paths Docker masks and makes read-only in every container that is
+// not privileged.
+var (
+	dockerMaskedPaths = []string{
+		"/proc/acpi",
+		"/proc/asound",
+		"/proc/interrupts",
+		"/proc/kcore",
+		"/proc/keys",
+		"/proc/latency_stats",
+		"/proc/sched_debug",
+		"/proc/scsi",
+		"/proc/timer_list",
+		"/proc/timer_stats",
+		"/sys/devices/virtual/powercap",
+		"/sys/firmware",
+	}
+	dockerReadonlyPaths = []string{
+		"/proc/bus",
+		"/proc/fs",
+		"/proc/irq",
+		"/proc/sys",
+		"/proc/sysrq-trigger",
+	}
+)
+
+// mapPaths maps linux.maskedPaths and linux.readonlyPaths to mounts. A
+// masked directory is covered by a read-only tmpfs and a masked file by
+// /dev/null. Docker mounts /sys read-only already; a read-only path of the
+// root filesystem becomes a read-only volume, which Docker fills with the
+// content of the image. stat, when not nil, tells directories from files
+// and which paths exist in the root filesystem of the bundle. Docker refuses
+// mounts inside /proc, so only its own defaults apply there.
+func (rc *runtimeConfig) mapPaths(spec *specs.Spec, stat rootfsStat) {
+	masked := make(map[string]bool)
+	for _, p := range spec.Linux.MaskedPaths {
+		p = filepath.Clean(p)
+		masked[p] = true
+		switch {
+		case containsPath(dockerMaskedPaths, p):
+		case isUnder(p, "/proc"):
+			rc.unsupported("masked path %s inside /proc", p)
+		default:
+			// A missing path is taken for a file, which is what runtimes
+			// try first too. /sys is that of the host.
+			dir := false
+			if isUnder(p, "/sys") {
+				fi, err := os.Stat(p)
+				dir = err == nil && fi.IsDir()
+			} else if stat != nil {
+				dir, _ = stat(p)
+			}
+			if dir {
+				rc.Mounts = append(rc.Mounts, runtimeMount{Type: "tmpfs", Target: p, ReadOnly: true, Options: []string{"ro"}})
+			} else {
+				rc.Mounts = append(rc.Mounts, runtimeMount{Type: "bind", Source: os.DevNull, Target: p, ReadOnly: true})
+			}
+		}
+	}
+
+	readonly := make(map[string]bool)
+	for _, p := range spec.Linux.ReadonlyPaths {
+		p = filepath.Clean(p)
+		readonly[p] = true
+		switch {
+		case masked[p], containsPath(dockerReadonlyPaths, p), containsPath(dockerMaskedPaths, p):
+		case isUnder(p, "/proc"):
+			rc.unsupported("read-only path %s inside /proc", p)
+		case isUnder(p, "/sys"), rc.ReadOnly:
+		default:
+			// Runtimes skip read-only paths that do not exist. Volumes
+			// only cover directories.
+			if stat != nil {
+				dir, err := stat(p)
+				if err != nil {
+					continue
+				}
+				if !dir {
+					rc.unsupported("read-only file %s, which volumes cannot cover", p)
+					continue
+				}
+			}
+			rc.Mounts = append(rc.Mounts, runtimeMount{Type: "volume", Target: p, ReadOnly: true})
+		}
+	}
+
+	var hidden, protected []string
+	for _, p := range dockerMaskedPaths {
+		if !masked[p] {
+			hidden = append(hidden, p)
+		}
+	}
+	for _, p := range dockerReadonlyPaths {
+		if !masked[p] && !readonly[p] {
+			protected = append(protected, p)
+		}
+	}
+	// Bundles without any such paths leave them to the runtime.
+	if len(spec.Linux.MaskedPaths) > 0 && len(hidden) > 0 {
+		rc.unsupported("access to %s, which are masked by default", strings.Join(hidden, ", "))
+	}
+	if len(spec.Linux.ReadonlyPaths) > 0 && len(protected) > 0 {
+		rc.unsupported("write access to %s, which are read-only by default", strings.Join(protected, ", "))
+	}
+}
+
+// rootfsStat resolves the absolute path p in the root filesystem of a
+// bundle, the way the kernel would inside the container, and reports whether
+// it is a directory. It fails when p does not exist.
+type rootfsStat func(p string) (dir bool, err error)
+
+// dirStat is the rootfsStat of the root filesystem directory rootfs.
+func dirStat(rootfs string) rootfsStat {
+	return func(p string) (bool, error) {
+		host, err := resolveInRootfs(rootfs, p)
+		if err != nil {
+			return false, err
+		}
+		fi, err := os.Stat(host)
+		if err != nil {
+			return false, err
+		}
+		return fi.IsDir(), nil
+	}
+}
+
+// resolveInRootfs follows symlinks in the absolute path p the way the
+// kernel would inside the container, never leaving the directory rootfs,
+// and returns the host path it ends at.
+func resolveInRootfs(rootfs, p string) (string, error) {
+	parts := splitPath(p)
+	cur := ""
+	hops := 0
+	for i := 0; i < len(parts); i++ {
+		next := path.Join(cur, parts[i])
+		fi, err := os.Lstat(filepath.Join(rootfs, next))
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if hops++; hops > maxSymlinks {
+				return "", fmt.Errorf("too many levels of symbolic links at %s", "/"+next)
+			}
+			target, err := os.Readlink(filepath.Join(rootfs, next))
+			if err != nil {
+				return "", err
+			}
+			base := cur
+			if path.IsAbs(target) {
+				base = ""
+			}
+			rest := append([]string{"/", base, target}, parts[i+1:]...)
+			parts = splitPath(path.Join(rest...))
+			cur, i = "", -1
+			continue
+		}
+		cur = next
+	}
+	return filepath.Join(rootfs, cur), nil
+}
+
+// containsPath reports whether paths lists path.
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnder reports whether path is dir or lies below it.
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
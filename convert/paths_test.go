@@ -0,0 +1,199 @@
+package convert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// writeTestRootfs creates a rootfs with directories, files and symlinks,
+// some of them climbing out of it.
+func writeTestRootfs(t *testing.T) string {
+	rootfs, err := ioutil.TempDir("", "oci2docker-paths")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"etc/secretdir", "opt", "var/lib"} {
+		if err := os.MkdirAll(filepath.Join(rootfs, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc/file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"opt/etclink": "/etc",
+		"opt/up":      "../../..",
+		"opt/rel":     "../etc/file",
+		"opt/loop":    "loop",
+		"opt/hostlib": "../../../var/lib",
+		"opt/dangle":  "/nowhere",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(rootfs, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rootfs
+}
+
+func TestResolveInRootfs(t *testing.T) {
+	rootfs := writeTestRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	tests := []struct {
+		path string
+		want string
+		err  string
+	}{
+		{path: "/", want: ""},
+		{path: "/etc/file", want: "etc/file"},
+		{path: "etc//secretdir/", want: "etc/secretdir"},
+		{path: "/opt/etclink", want: "etc"},
+		{path: "/opt/etclink/file", want: "etc/file"},
+		{path: "/opt/rel", want: "etc/file"},
+		{path: "/opt/up", want: ""},
+		{path: "/opt/up/etc/file", want: "etc/file"},
+		{path: "/opt/up/opt/up/opt/etclink/secretdir", want: "etc/secretdir"},
+		{path: "/opt/hostlib", want: "var/lib"},
+		{path: "/../../etc/file", want: "etc/file"},
+		{path: "/opt/loop", err: "too many levels of symbolic links at /opt/loop"},
+		{path: "/opt/dangle", err: "no such file or directory"},
+		{path: "/missing", err: "no such file or directory"},
+		{path: "/etc/file/sub", err: "not a directory"},
+	}
+	for _, tt := range tests {
+		got, err := resolveInRootfs(rootfs, tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolveInRootfs(%q): got error %v, want %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if want := filepath.Join(rootfs, tt.want); err != nil || got != want {
+			t.Errorf("resolveInRootfs(%q) = %q, %v, want %q", tt.path, got, err, want)
+		}
+	}
+}
+
+func TestMapPaths(t *testing.T) {
+	rootfs := writeTestRootfs(t)
+	defer os.RemoveAll(rootfs)
+
+	tests := []struct {
+		name     string
+		masked   []string
+		readonly []string
+		readOnly bool
+		want     []runtimeMount
+		// unsupported are substrings of the expected reports, in order.
+		unsupported []string
+	}{
+		{name: "none"},
+		{
+			name:   "masked paths",
+			masked: append([]string{"/etc/secretdir", "/etc/file", "/opt/etclink/secretdir/", "/missing", "/proc/self", "/sys/kernel/security"}, dockerMaskedPaths...),
+			want: []runtimeMount{
+				{Type: "tmpfs", Target: "/etc/secretdir", ReadOnly: true, Options: []string{"ro"}},
+				{Type: "bind", Source: os.DevNull, Target: "/etc/file", ReadOnly: true},
+				{Type: "tmpfs", Target: "/opt/etclink/secretdir", ReadOnly: true, Options: []string{"ro"}},
+				{Type: "bind", Source: os.DevNull, Target: "/missing", ReadOnly: true},
+				{Type: "tmpfs", Target: "/sys/kernel/security", ReadOnly: true, Options: []string{"ro"}},
+			},
+			unsupported: []string{"masked path /proc/self inside /proc"},
+		},
+		{
+			name:     "read-only paths",
+			readonly: append([]string{"/etc", "/opt/up/var/lib", "/etc/file", "/opt/rel", "/missing", "/opt/loop", "/proc/self", "/sys/kernel"}, dockerReadonlyPaths...),
+			want: []runtimeMount{
+				{Type: "volume", Target: "/etc", ReadOnly: true},
+				{Type: "volume", Target: "/opt/up/var/lib", ReadOnly: true},
+			},
+			unsupported: []string{
+				"read-only file /etc/file, which volumes cannot cover",
+				"read-only file /opt/rel, which volumes cannot cover",
+				"read-only path /proc/self inside /proc",
+			},
+		},
+		{
+			name:     "read-only root",
+			readonly: append([]string{"/etc"}, dockerReadonlyPaths...),
+			readOnly: true,
+		},
+		{
+			name:     "masked and read-only",
+			masked:   []string{"/etc/secretdir", "/proc/sys"},
+			readonly: []string{"/etc/secretdir", "/proc/bus"},
+			want: []runtimeMount{
+				{Type: "tmpfs", Target: "/etc/secretdir", ReadOnly: true, Options: []string{"ro"}},
+			},
+			unsupported: []string{
+				"masked path /proc/sys inside /proc",
+				"access to /proc/acpi, /proc/asound",
+				"write access to /proc/fs, /proc/irq, /proc/sysrq-trigger, which are read-only by default",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &specs.Spec{}
+			spec.Linux.MaskedPaths = tt.masked
+			spec.Linux.ReadonlyPaths = tt.readonly
+			rc := &runtimeConfig{ReadOnly: tt.readOnly}
+			rc.mapPaths(spec, dirStat(rootfs))
+			if !reflect.DeepEqual(rc.Mounts, tt.want) {
+				t.Errorf("got mounts %+v, want %+v", rc.Mounts, tt.want)
+			}
+			if len(rc.Unsupported) != len(tt.unsupported) {
+				t.Fatalf("got unsupported %q, want %q", rc.Unsupported, tt.unsupported)
+			}
+			for i, u := range tt.unsupported {
+				if !strings.Contains(rc.Unsupported[i], u) {
+					t.Errorf("got unsupported %q, want %q", rc.Unsupported[i], u)
+				}
+			}
+		})
+	}
+}
+
+func TestMapPathsArchive(t *testing.T) {
+	file := writeTestArchive(t, []string{
+		"config.json", "rootfs/", "rootfs/etc/", "rootfs/etc/secretdir/", "rootfs/etc/file", "rootfs/etc/hosts", "rootfs/var/lib/data",
+	}, true)
+	defer os.Remove(file)
+	b, err := openBundleArchive(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	spec := &specs.Spec{}
+	spec.Root.Path = RootfsDir
+	spec.Linux.MaskedPaths = []string{"/etc/secretdir", "/etc/file", "/var/lib", "/missing"}
+	spec.Linux.ReadonlyPaths = []string{"/etc", "/etc/hosts", "/opt"}
+	stat, err := bundleRootfsStat(b.dir, spec, Options{archive: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := &runtimeConfig{}
+	rc.mapPaths(spec, stat)
+
+	want := []runtimeMount{
+		{Type: "tmpfs", Target: "/etc/secretdir", ReadOnly: true, Options: []string{"ro"}},
+		{Type: "bind", Source: os.DevNull, Target: "/etc/file", ReadOnly: true},
+		{Type: "tmpfs", Target: "/var/lib", ReadOnly: true, Options: []string{"ro"}},
+		{Type: "bind", Source: os.DevNull, Target: "/missing", ReadOnly: true},
+		{Type: "volume", Target: "/etc", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(rc.Mounts, want) {
+		t.Errorf("got mounts %+v, want %+v", rc.Mounts, want)
+	}
+	if len(rc.Unsupported) == 0 || !strings.Contains(rc.Unsupported[0], "read-only file /etc/hosts") {
+		t.Errorf("got unsupported %q, want the read-only file /etc/hosts first", rc.Unsupported)
+	}
+}
@@ -0,0 +1,154 @@
+package convert
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// expectedDevices are the device nodes a rootfs may legitimately ship.
+var expectedDevices = map[string]bool{
+	"dev/null":    true,
+	"dev/zero":    true,
+	"dev/full":    true,
+	"dev/random":  true,
+	"dev/urandom": true,
+	"dev/tty":     true,
+	"dev/console": true,
+	"dev/ptmx":    true,
+}
+
+// rootfsIssue is something suspicious found in the rootfs.
+type rootfsIssue struct {
+	Path    string
+	Problem string
+}
+
+// rootfsPolicy treats the rootfs as untrusted input. Every entry is checked
+// before it is archived: paths must stay inside the root, symlinks that
+// climb out of it are rewritten, and setuid/setgid files, world-writable
+// directories and unusual device nodes are reported.
+type rootfsPolicy struct {
+	// strict fails the conversion when any issue was found.
+	strict bool
+	issues []rootfsIssue
+}
+
+func (p *rootfsPolicy) report(name string, format string, args ...interface{}) {
+	issue := rootfsIssue{Path: name, Problem: fmt.Sprintf(format, args...)}
+	logrus.Warnf("rootfs: %s: %s", issue.Path, issue.Problem)
+	p.issues = append(p.issues, issue)
+}
+
+// check inspects hdr, sanitizing it where that is safe. Entries that cannot
+// be archived safely are rejected with an error.
+func (p *rootfsPolicy) check(hdr *tar.Header) error {
+	name, err := cleanEntryName(hdr.Name)
+	if err != nil {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeLink:
+		if _, err := cleanEntryName(hdr.Linkname); err != nil {
+			return fmt.Errorf("hard link %s: %v", name, err)
+		}
+	case tar.TypeSymlink:
+		if target, escapes := clampSymlink(name, hdr.Linkname); escapes {
+			p.report(name, "symlink to %q escapes the rootfs, rewritten to %q", hdr.Linkname, target)
+			hdr.Linkname = target
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		mode := os.FileMode(hdr.Mode)
+		if hdr.Mode&04000 != 0 {
+			p.report(name, "setuid file (mode %04o)", mode.Perm()|04000)
+		}
+		if hdr.Mode&02000 != 0 {
+			p.report(name, "setgid file (mode %04o)", mode.Perm()|02000)
+		}
+	case tar.TypeDir:
+		if hdr.Mode&0002 != 0 && hdr.Mode&01000 == 0 {
+			p.report(name, "world-writable directory without sticky bit")
+		}
+	case tar.TypeChar, tar.TypeBlock:
+		if !expectedDevices[strings.TrimSuffix(name, "/")] {
+			p.report(name, "unexpected device node %d:%d", hdr.Devmajor, hdr.Devminor)
+		}
+	}
+	return nil
+}
+
+// err fails the conversion in strict mode if issues were found.
+func (p *rootfsPolicy) err() error {
+	if p.strict && len(p.issues) > 0 {
+		return fmt.Errorf("%d rootfs policy violations", len(p.issues))
+	}
+	return nil
+}
+
+// cleanEntryName rejects archive names that are absolute or climb out of
+// the root, and returns the name in canonical form.
+func cleanEntryName(name string) (string, error) {
+	if path.IsAbs(name) {
+		return "", fmt.Errorf("absolute path %q in rootfs", name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("path %q leaves the rootfs", name)
+		}
+	}
+	return path.Clean(name), nil
+}
+
+// clampSymlink resolves a relative symlink target lexically and reports
+// whether it climbs above the root. In that case the equivalent target the
+// kernel would use inside the container is returned.
+func clampSymlink(name string, target string) (string, bool) {
+	if path.IsAbs(target) {
+		return target, false
+	}
+	depth := strings.Count(path.Clean(name), "/")
+	for _, elem := range strings.Split(target, "/") {
+		switch elem {
+		case "", ".":
+		case "..":
+			depth--
+		default:
+			depth++
+		}
+		if depth < 0 {
+			return path.Join("/", path.Dir(name), target), true
+		}
+	}
+	return target, false
+}
+
+// securePath joins name to dst without following any symlink below dst,
+// so that a hostile archive cannot write outside the destination.
+func securePath(dst string, name string) (string, error) {
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return "", err
+	}
+	cur := dst
+	elems := strings.Split(name, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		cur = filepath.Join(cur, elem)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("refusing to write %q through symlink %q", name, cur)
+		}
+	}
+	return filepath.Join(dst, name), nil
+}
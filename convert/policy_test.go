@@ -0,0 +1,150 @@
+package convert
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "etc/passwd", want: "etc/passwd"},
+		{name: "./etc//passwd", want: "etc/passwd"},
+		{name: "etc/", want: "etc"},
+		{name: "/etc/passwd", err: "absolute path"},
+		{name: "../etc/passwd", err: "leaves the rootfs"},
+		{name: "etc/../../passwd", err: "leaves the rootfs"},
+		{name: "etc/../passwd", err: "leaves the rootfs"},
+	}
+	for _, tt := range tests {
+		got, err := cleanEntryName(tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("cleanEntryName(%q): got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("cleanEntryName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestClampSymlink(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		want    string
+		escapes bool
+	}{
+		{name: "usr/lib/libc.so", target: "../../lib/libc.so", want: "../../lib/libc.so"},
+		{name: "bin/sh", target: "busybox", want: "busybox"},
+		{name: "etc/mtab", target: "/proc/mounts", want: "/proc/mounts"},
+		{name: "etc/x", target: "./../y", want: "./../y"},
+		{name: "link", target: "../etc/passwd", want: "/etc/passwd", escapes: true},
+		{name: "a/b", target: "../../etc", want: "/etc", escapes: true},
+		{name: "a/b", target: "../x/../../y", want: "/y", escapes: true},
+		{name: "a/b/c", target: "../../../../../../etc/shadow", want: "/etc/shadow", escapes: true},
+	}
+	for _, tt := range tests {
+		got, escapes := clampSymlink(tt.name, tt.target)
+		if got != tt.want || escapes != tt.escapes {
+			t.Errorf("clampSymlink(%q, %q) = %q, %v, want %q, %v", tt.name, tt.target, got, escapes, tt.want, tt.escapes)
+		}
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	dst, err := ioutil.TempDir("", "oci2docker-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	if err := os.Mkdir(filepath.Join(dst, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/tmp", filepath.Join(dst, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(dst, "dir", "up")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "dir/file", want: "dir/file"},
+		{name: "new/sub/file", want: "new/sub/file"},
+		{name: "link", want: "link"},
+		{name: "link/file", err: "through symlink"},
+		{name: "dir/up/file", err: "through symlink"},
+		{name: "../file", err: "leaves the rootfs"},
+		{name: "/etc/passwd", err: "absolute path"},
+	}
+	for _, tt := range tests {
+		got, err := securePath(dst, tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("securePath(%q): got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if want := filepath.Join(dst, tt.want); err != nil || got != want {
+			t.Errorf("securePath(%q) = %q, %v, want %q", tt.name, got, err, want)
+		}
+	}
+}
+
+func TestRootfsPolicyCheck(t *testing.T) {
+	tests := []struct {
+		hdr      tar.Header
+		linkname string
+		issues   int
+		err      string
+	}{
+		{hdr: tar.Header{Name: "bin/sh", Typeflag: tar.TypeReg, Mode: 0755}},
+		{hdr: tar.Header{Name: "bin/su", Typeflag: tar.TypeReg, Mode: 04755}, issues: 1},
+		{hdr: tar.Header{Name: "bin/wall", Typeflag: tar.TypeReg, Mode: 06755}, issues: 2},
+		{hdr: tar.Header{Name: "tmp", Typeflag: tar.TypeDir, Mode: 01777}},
+		{hdr: tar.Header{Name: "data", Typeflag: tar.TypeDir, Mode: 0777}, issues: 1},
+		{hdr: tar.Header{Name: "dev/null", Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3}},
+		{hdr: tar.Header{Name: "dev/sda", Typeflag: tar.TypeBlock, Devmajor: 8}, issues: 1},
+		{hdr: tar.Header{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "usr/lib"}, linkname: "usr/lib"},
+		{hdr: tar.Header{Name: "etc/up", Typeflag: tar.TypeSymlink, Linkname: "../../.."}, linkname: "/", issues: 1},
+		{hdr: tar.Header{Name: "bin/ln", Typeflag: tar.TypeLink, Linkname: "../bin/sh"}, err: "hard link bin/ln"},
+		{hdr: tar.Header{Name: "../escape", Typeflag: tar.TypeReg}, err: "leaves the rootfs"},
+	}
+	for _, tt := range tests {
+		p := &rootfsPolicy{strict: true}
+		hdr := tt.hdr
+		err := p.check(&hdr)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("check(%s): got error %v, want %q", tt.hdr.Name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("check(%s): %v", tt.hdr.Name, err)
+			continue
+		}
+		if len(p.issues) != tt.issues {
+			t.Errorf("check(%s): got issues %v, want %d", tt.hdr.Name, p.issues, tt.issues)
+		}
+		if (p.err() != nil) != (tt.issues > 0) {
+			t.Errorf("check(%s): strict error %v with %d issues", tt.hdr.Name, p.err(), tt.issues)
+		}
+		if tt.linkname != "" && hdr.Linkname != tt.linkname {
+			t.Errorf("check(%s): got link %q, want %q", tt.hdr.Name, hdr.Linkname, tt.linkname)
+		}
+	}
+}
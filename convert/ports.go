@@ -0,0 +1,180 @@
+package convert
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// portAnnotations are the bundle annotations ports to expose are read
+// from. Values list ports the same way --port does; for
+// io.openshift.expose-services each entry is port:name.
+var portAnnotations = []string{
+	"org.opencontainers.image.exposedPorts",
+	"io.openshift.expose-services",
+}
+
+// exposedPort is one port of the image.
+type exposedPort struct {
+	port  int
+	proto string
+}
+
+func (p exposedPort) String() string {
+	return strconv.Itoa(p.port) + "/" + p.proto
+}
+
+// ParsePorts checks the ports named on the command line. A value is a port
+// or a range of ports such as 8000-8010, optionally followed by /tcp or
+// /udp, and can hold several of them separated by commas or spaces. The
+// result lists every port once, as port/protocol.
+func ParsePorts(values []string) ([]string, error) {
+	ports, err := parsePorts(values)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ports))
+	for i, p := range ports {
+		names[i] = p.String()
+	}
+	return names, nil
+}
+
+// parsePorts expands the port specifications in values, sorted and without
+// duplicates.
+func parsePorts(values []string) ([]exposedPort, error) {
+	seen := make(map[exposedPort]bool)
+	var ports []exposedPort
+	for _, v := range values {
+		fields := strings.FieldsFunc(v, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})
+		for _, field := range fields {
+			expanded, err := parsePortRange(field)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range expanded {
+				if !seen[p] {
+					seen[p] = true
+					ports = append(ports, p)
+				}
+			}
+		}
+	}
+	sort.Sort(byPort(ports))
+	return ports, nil
+}
+
+func parsePortRange(spec string) ([]exposedPort, error) {
+	rng, proto := spec, "tcp"
+	if i := strings.Index(spec, "/"); i >= 0 {
+		rng, proto = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	if proto != "tcp" && proto != "udp" {
+		return nil, fmt.Errorf("invalid port %q: protocol must be tcp or udp", spec)
+	}
+	first, last := rng, rng
+	if i := strings.Index(rng, "-"); i >= 0 {
+		first, last = rng[:i], rng[i+1:]
+	}
+	start, err := parsePortNumber(first)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %v", spec, err)
+	}
+	end, err := parsePortNumber(last)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %v", spec, err)
+	}
+	if end < start {
+		return nil, fmt.Errorf("invalid port %q: range ends before it starts", spec)
+	}
+	var ports []exposedPort
+	for p := start; p <= end; p++ {
+		ports = append(ports, exposedPort{port: p, proto: proto})
+	}
+	return ports, nil
+}
+
+func parsePortNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if n < 1 || n > 65535 {
+		return 0, fmt.Errorf("%d is out of range 1-65535", n)
+	}
+	return n, nil
+}
+
+// annotationPorts returns the port specifications found in the bundle
+// annotations.
+func annotationPorts(annotations map[string]string) []string {
+	var values []string
+	for _, key := range portAnnotations {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		if key == "io.openshift.expose-services" {
+			var ports []string
+			for _, service := range strings.Split(value, ",") {
+				if i := strings.Index(service, ":"); i >= 0 {
+					service = service[:i]
+				}
+				ports = append(ports, strings.TrimSpace(service))
+			}
+			value = strings.Join(ports, ",")
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// formatPorts lists the exposed ports of an image configuration in order,
+// with runs of consecutive ports written as ranges, for EXPOSE.
+func formatPorts(exposed map[string]struct{}) string {
+	var values []string
+	for p := range exposed {
+		values = append(values, p)
+	}
+	ports, err := parsePorts(values)
+	if err != nil {
+		return strings.Join(values, " ")
+	}
+	var specs []string
+	for _, proto := range []string{"tcp", "udp"} {
+		var run []exposedPort
+		for _, p := range ports {
+			if p.proto == proto {
+				run = append(run, p)
+			}
+		}
+		for i := 0; i < len(run); {
+			j := i
+			for j+1 < len(run) && run[j+1].port == run[j].port+1 {
+				j++
+			}
+			if j > i {
+				specs = append(specs, fmt.Sprintf("%d-%d/%s", run[i].port, run[j].port, proto))
+			} else {
+				specs = append(specs, run[i].String())
+			}
+			i = j + 1
+		}
+	}
+	return strings.Join(specs, " ")
+}
+
+// byPort sorts ports by number, then protocol.
+type byPort []exposedPort
+
+func (s byPort) Len() int      { return len(s) }
+func (s byPort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPort) Less(i, j int) bool {
+	if s[i].port != s[j].port {
+		return s[i].port < s[j].port
+	}
+	return s[i].proto < s[j].proto
+}
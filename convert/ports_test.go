@@ -0,0 +1,74 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+		err    string
+	}{
+		{values: nil, want: []string{}},
+		{values: []string{"80"}, want: []string{"80/tcp"}},
+		{values: []string{"53/UDP, 53"}, want: []string{"53/tcp", "53/udp"}},
+		{values: []string{"8000-8002/tcp 443", "443/tcp"}, want: []string{"443/tcp", "8000/tcp", "8001/tcp", "8002/tcp"}},
+		{values: []string{"7-7"}, want: []string{"7/tcp"}},
+		{values: []string{"1,65535"}, want: []string{"1/tcp", "65535/tcp"}},
+		{values: []string{"80/sctp"}, err: "protocol must be tcp or udp"},
+		{values: []string{"http"}, err: `"http" is not a number`},
+		{values: []string{"0"}, err: "out of range"},
+		{values: []string{"65536"}, err: "out of range"},
+		{values: []string{"80-"}, err: `"" is not a number`},
+		{values: []string{"90-80"}, err: "range ends before it starts"},
+		{values: []string{"80", "1-2-3"}, err: `invalid port "1-2-3"`},
+	}
+	for _, tt := range tests {
+		got, err := ParsePorts(tt.values)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParsePorts(%q): got error %v, want %q", tt.values, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePorts(%q) = %q, %v, want %q", tt.values, got, err, tt.want)
+		}
+	}
+}
+
+func TestAnnotationPorts(t *testing.T) {
+	got := annotationPorts(map[string]string{
+		"io.openshift.expose-services":          "8080:http, 8443:https",
+		"org.opencontainers.image.exposedPorts": "9000-9001/udp",
+		"org.example.other":                     "22",
+	})
+	want := []string{"9000-9001/udp", "8080,8443"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("annotationPorts = %q, want %q", got, want)
+	}
+}
+
+func TestFormatPorts(t *testing.T) {
+	tests := []struct {
+		ports []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"80/tcp"}, "80/tcp"},
+		{[]string{"8002/tcp", "8000/tcp", "8001/tcp", "443/tcp"}, "443/tcp 8000-8002/tcp"},
+		{[]string{"53/udp", "53/tcp", "54/udp"}, "53/tcp 53-54/udp"},
+	}
+	for _, tt := range tests {
+		exposed := make(map[string]struct{})
+		for _, p := range tt.ports {
+			exposed[p] = struct{}{}
+		}
+		if got := formatPorts(exposed); got != tt.want {
+			t.Errorf("formatPorts(%q) = %q, want %q", tt.ports, got, tt.want)
+		}
+	}
+}
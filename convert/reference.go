@@ -0,0 +1,179 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// annotationVersion is the bundle annotation the default tag of the image
+// is taken from.
+const annotationVersion = "org.opencontainers.image.version"
+
+// The grammar of Docker image references, as implemented by the docker
+// distribution reference package.
+var (
+	referencePathComponent   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	referenceDomain          = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	referenceTag             = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	referenceDigest          = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+	referenceTagInvalidChars = regexp.MustCompile(`[^\w.-]+`)
+)
+
+// maxNameLength is the longest repository name, domain included, a
+// registry accepts.
+const maxNameLength = 255
+
+// reference is a parsed Docker image reference:
+// [domain/]path[:tag][@digest].
+type reference struct {
+	domain string
+	path   string
+	tag    string
+	digest string
+}
+
+// parseReference parses and validates a Docker image reference.
+func parseReference(s string) (reference, error) {
+	var r reference
+	if s == "" {
+		return r, fmt.Errorf("empty image reference")
+	}
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.digest = name[:i], name[i+1:]
+		if !referenceDigest.MatchString(r.digest) {
+			return r, fmt.Errorf("invalid image reference %q: invalid digest %q", s, r.digest)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.tag = name[:i], name[i+1:]
+		if !referenceTag.MatchString(r.tag) {
+			return r, fmt.Errorf("invalid image reference %q: invalid tag %q", s, r.tag)
+		}
+	}
+	if len(name) > maxNameLength {
+		return r, fmt.Errorf("invalid image reference %q: name is longer than %d characters", s, maxNameLength)
+	}
+
+	r.path = name
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			r.domain, r.path = first, name[i+1:]
+			if !referenceDomain.MatchString(r.domain) {
+				return r, fmt.Errorf("invalid image reference %q: invalid registry host %q", s, r.domain)
+			}
+		}
+	}
+	if r.path == "" {
+		return r, fmt.Errorf("invalid image reference %q: missing repository name", s)
+	}
+	for _, component := range strings.Split(r.path, "/") {
+		if referencePathComponent.MatchString(component) {
+			continue
+		}
+		if referencePathComponent.MatchString(strings.ToLower(component)) {
+			return r, fmt.Errorf("invalid image reference %q: repository name must be lowercase", s)
+		}
+		return r, fmt.Errorf("invalid image reference %q: invalid repository name component %q", s, component)
+	}
+	return r, nil
+}
+
+// name returns the repository name as written, domain included.
+func (r reference) name() string {
+	if r.domain == "" {
+		return r.path
+	}
+	return r.domain + "/" + r.path
+}
+
+func (r reference) String() string {
+	s := r.name()
+	if r.tag != "" {
+		s += ":" + r.tag
+	}
+	if r.digest != "" {
+		s += "@" + r.digest
+	}
+	return s
+}
+
+// registry returns the host of the registry holding the repository.
+func (r reference) registry() string {
+	if r.domain == "" || r.domain == "docker.io" || r.domain == "index.docker.io" {
+		return defaultRegistry
+	}
+	return r.domain
+}
+
+// repository returns the repository path on the registry. Official images
+// on Docker Hub live under library/.
+func (r reference) repository() string {
+	if r.registry() == defaultRegistry && !strings.Contains(r.path, "/") {
+		return "library/" + r.path
+	}
+	return r.path
+}
+
+// ParseImageNames checks the image names given on the command line. Names
+// must be valid Docker references; a digest cannot be given since it is
+// only known once the image is written.
+func ParseImageNames(names []string) ([]string, error) {
+	var parsed []string
+	for _, name := range names {
+		r, err := parseReference(name)
+		if err != nil {
+			return nil, err
+		}
+		if r.digest != "" {
+			return nil, fmt.Errorf("image name %q cannot contain a digest", name)
+		}
+		parsed = append(parsed, r.String())
+	}
+	return parsed, nil
+}
+
+// defaultTag derives the tag of images named without one from the
+// bundle: its version annotation, or else its ociVersion.
+func defaultTag(spec *specs.Spec) string {
+	for _, v := range []string{spec.Annotations[annotationVersion], spec.Version} {
+		tag := referenceTagInvalidChars.ReplaceAllString(v, "-")
+		tag = strings.TrimLeft(tag, ".-")
+		if len(tag) > 128 {
+			tag = tag[:128]
+		}
+		if referenceTag.MatchString(tag) {
+			return tag
+		}
+	}
+	return "latest"
+}
+
+// tagImageNames adds the default tag of the bundle at path to the image
+// and push names of opts that have none.
+func tagImageNames(path string, opts *Options) error {
+	spec := getConfigSpec(path)
+	if spec == nil {
+		return ErrNoConfig
+	}
+	tag := defaultTag(spec)
+	for _, names := range []*[]string{&opts.ImageNames, &opts.Push} {
+		tagged := make([]string, len(*names))
+		for i, name := range *names {
+			r, err := parseReference(name)
+			if err != nil {
+				return err
+			}
+			if r.tag == "" && r.digest == "" {
+				r.tag = tag
+			}
+			tagged[i] = r.String()
+		}
+		*names = tagged
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		ref        string
+		want       reference
+		registry   string
+		repository string
+		err        string
+	}{
+		{
+			ref:        "busybox",
+			want:       reference{path: "busybox"},
+			registry:   defaultRegistry,
+			repository: "library/busybox",
+		},
+		{
+			ref:        "cts/hello-docker:1.0",
+			want:       reference{path: "cts/hello-docker", tag: "1.0"},
+			registry:   defaultRegistry,
+			repository: "cts/hello-docker",
+		},
+		{
+			ref:        "docker.io/busybox:latest",
+			want:       reference{domain: "docker.io", path: "busybox", tag: "latest"},
+			registry:   defaultRegistry,
+			repository: "library/busybox",
+		},
+		{
+			ref:        "localhost:5000/a/b/c:v1@" + digest,
+			want:       reference{domain: "localhost:5000", path: "a/b/c", tag: "v1", digest: digest},
+			registry:   "localhost:5000",
+			repository: "a/b/c",
+		},
+		{
+			ref:        "localhost/app",
+			want:       reference{domain: "localhost", path: "app"},
+			registry:   "localhost",
+			repository: "app",
+		},
+		{
+			ref:        "registry.example.com/my_app__x.y-z",
+			want:       reference{domain: "registry.example.com", path: "my_app__x.y-z"},
+			registry:   "registry.example.com",
+			repository: "my_app__x.y-z",
+		},
+		{ref: "", err: "empty image reference"},
+		{ref: "Busybox", err: "must be lowercase"},
+		{ref: "busybox:", err: "invalid tag"},
+		{ref: "busybox:-1", err: "invalid tag"},
+		{ref: "busybox:" + strings.Repeat("a", 129), err: "invalid tag"},
+		{ref: "busybox@sha256:abc", err: "invalid digest"},
+		{ref: "-bad.example.com/app", err: "invalid registry host"},
+		{ref: "example.com/", err: "missing repository name"},
+		{ref: "cts//hello", err: "invalid repository name component"},
+		{ref: "cts/hello-", err: "invalid repository name component"},
+		{ref: "cts/" + strings.Repeat("a", maxNameLength), err: "longer than"},
+	}
+	for _, tt := range tests {
+		r, err := parseReference(tt.ref)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseReference(%q): got error %v, want %q", tt.ref, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseReference(%q): %v", tt.ref, err)
+			continue
+		}
+		if r != tt.want {
+			t.Errorf("parseReference(%q) = %+v, want %+v", tt.ref, r, tt.want)
+		}
+		if r.String() != tt.ref {
+			t.Errorf("parseReference(%q).String() = %q", tt.ref, r.String())
+		}
+		if r.registry() != tt.registry || r.repository() != tt.repository {
+			t.Errorf("parseReference(%q): registry %q, repository %q, want %q, %q", tt.ref, r.registry(), r.repository(), tt.registry, tt.repository)
+		}
+	}
+}
+
+func TestParseImageNames(t *testing.T) {
+	got, err := ParseImageNames([]string{"busybox", "cts/hello:1.0"})
+	if err != nil || strings.Join(got, " ") != "busybox cts/hello:1.0" {
+		t.Errorf("ParseImageNames = %q, %v", got, err)
+	}
+	for _, name := range []string{"Busybox", "busybox@sha256:" + strings.Repeat("0", 64)} {
+		if _, err := ParseImageNames([]string{name}); err == nil {
+			t.Errorf("ParseImageNames(%q) succeeded", name)
+		}
+	}
+}
+
+func TestDefaultTag(t *testing.T) {
+	tests := []struct {
+		version    string
+		ociVersion string
+		want       string
+	}{
+		{"", "1.0.0-rc1", "1.0.0-rc1"},
+		{"", "", "latest"},
+		{"1.0", "1.0.0-rc1", "1.0"},
+		{"v2.1.0-rc1", "", "v2.1.0-rc1"},
+		{"1.0+build 5", "", "1.0-build-5"},
+		{"..1.0", "", "1.0"},
+		{"-", "1.0.0-rc1", "1.0.0-rc1"},
+		{"-", "", "latest"},
+		{strings.Repeat("a", 200), "", strings.Repeat("a", 128)},
+	}
+	for _, tt := range tests {
+		spec := &specs.Spec{Version: tt.ociVersion}
+		if tt.version != "" {
+			spec.Annotations = map[string]string{annotationVersion: tt.version}
+		}
+		if got := defaultTag(spec); got != tt.want {
+			t.Errorf("defaultTag(%q, %q) = %q, want %q", tt.version, tt.ociVersion, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	// defaultRegistry is where references without a registry host go.
+	defaultRegistry = "registry-1.docker.io"
+	// defaultChunkSize is the blob size above which uploads are chunked.
+	defaultChunkSize = 32 << 20
+)
+
+// registryClient talks to a Docker Registry HTTP API v2 endpoint on behalf
+// of a single repository.
+type registryClient struct {
+	scheme string
+	host   string
+	repo   string
+	// mountFrom lists repositories on the same registry that blobs may be
+	// mounted from instead of uploaded.
+	mountFrom []string
+	chunkSize int64
+
+	client   *http.Client
+	username string
+	password string
+	// authorization is the Authorization header value sent with every
+	// request once the registry asked for credentials.
+	authorization string
+}
+
+type dockerConfigFile struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredsStore string `json:"credsStore,omitempty"`
+}
+
+func newRegistryClient(host string, repo string, opts Options) *registryClient {
+	c := &registryClient{
+		scheme:    "https",
+		host:      host,
+		repo:      repo,
+		mountFrom: opts.MountFrom,
+		chunkSize: defaultChunkSize,
+		client:    &http.Client{},
+	}
+	if opts.InsecureRegistry || isLocalRegistry(host) {
+		c.scheme = "http"
+	}
+	c.username, c.password = loadRegistryAuth(host)
+	return c
+}
+
+func isLocalRegistry(host string) bool {
+	h := host
+	if i := strings.LastIndex(h, ":"); i >= 0 {
+		h = h[:i]
+	}
+	return h == "localhost" || h == "127.0.0.1" || h == "[::1]"
+}
+
+// loadRegistryAuth reads the credentials docker login stored for host.
+func loadRegistryAuth(host string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	var cfg dockerConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		logrus.Debugf("Unmarshal docker config failed: %v", err)
+		return "", ""
+	}
+
+	keys := []string{host, "https://" + host, "http://" + host, "https://" + host + "/v1/", "https://" + host + "/v2/"}
+	if host == defaultRegistry {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io", "docker.io")
+	}
+	for _, key := range keys {
+		entry, ok := cfg.Auths[key]
+		if !ok || entry.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			logrus.Debugf("Invalid auth for %s in docker config: %v", key, err)
+			continue
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) == 2 {
+			return parts[0], parts[1]
+		}
+	}
+	if cfg.CredsStore != "" {
+		logrus.Debugf("Credential store %q is not supported, pushing to %s anonymously", cfg.CredsStore, host)
+	}
+	return "", ""
+}
+
+func (c *registryClient) url(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s://%s/v2/%s", c.scheme, c.host, fmt.Sprintf(format, args...))
+}
+
+// do sends a request, answering an authentication challenge once. body is
+// called for every attempt so that the request can be replayed.
+func (c *registryClient) do(method string, rawurl string, header http.Header, body func() (io.ReadCloser, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var rc io.ReadCloser
+		if body != nil {
+			var err error
+			if rc, err = body(); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequest(method, rawurl, rc)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if rc != nil {
+			if n := header.Get("Content-Length"); n != "" {
+				fmt.Sscanf(n, "%d", &req.ContentLength)
+			}
+		}
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authorize(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authorize answers a Basic or Bearer WWW-Authenticate challenge.
+func (c *registryClient) authorize(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.username == "" {
+			return fmt.Errorf("registry %s requires credentials, run docker login first", c.host)
+		}
+		c.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.username+":"+c.password))
+		return nil
+	case "bearer":
+		token, err := c.fetchToken(params)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+	}
+	return fmt.Errorf("registry %s: unsupported authentication challenge %q", c.host, challenge)
+}
+
+func (c *registryClient) fetchToken(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry %s: invalid token realm %q", c.host, params["realm"])
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	q.Add("scope", fmt.Sprintf("repository:%s:pull,push", c.repo))
+	for _, from := range c.mountFrom {
+		q.Add("scope", fmt.Sprintf("repository:%s:pull", from))
+	}
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s: token request failed: %s", c.host, resp.Status)
+	}
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("registry %s: invalid token response: %v", c.host, err)
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	return tok.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header into its scheme and
+// parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[strings.ToLower(key)] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
+
+func registryError(resp *http.Response, what string) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s: %s %s", what, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// blobExists checks with a HEAD request whether the repository has digest.
+func (c *registryClient) blobExists(digest string) (bool, error) {
+	resp, err := c.do("HEAD", c.url("%s/blobs/%s", c.repo, digest), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("checking blob %s: %s", digest, resp.Status)
+}
+
+// startUpload opens an upload session, or mounts digest from one of the
+// mountFrom repositories. It returns an empty location when the blob was
+// mounted.
+func (c *registryClient) startUpload(digest string) (string, error) {
+	for _, from := range c.mountFrom {
+		u := c.url("%s/blobs/uploads/?mount=%s&from=%s", c.repo, url.QueryEscape(digest), url.QueryEscape(from))
+		resp, err := c.do("POST", u, nil, nil)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusCreated:
+			logrus.Debugf("Mounted blob %s from %s", digest, from)
+			return "", nil
+		case http.StatusAccepted:
+			// The registry could not mount and opened a regular
+			// upload instead.
+			return c.location(resp)
+		}
+	}
+
+	resp, err := c.do("POST", c.url("%s/blobs/uploads/", c.repo), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", registryError(resp, "starting upload of "+digest)
+	}
+	return c.location(resp)
+}
+
+// location resolves the Location header of an upload response.
+func (c *registryClient) location(resp *http.Response) (string, error) {
+	loc, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("registry %s: upload response without location: %v", c.host, err)
+	}
+	return loc.String(), nil
+}
+
+func withDigest(location string, digest string) string {
+	sep := "?"
+	if strings.Contains(location, "?") {
+		sep = "&"
+	}
+	return location + sep + "digest=" + url.QueryEscape(digest)
+}
+
+// pushBlob uploads the blob stored at file unless the registry already has
+// it. Small blobs go in a single PUT, large ones in chunks.
+func (c *registryClient) pushBlob(desc descriptor, file string) error {
+	exists, err := c.blobExists(desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		logrus.Debugf("Blob %s already exists", desc.Digest)
+		return nil
+	}
+	location, err := c.startUpload(desc.Digest)
+	if err != nil || location == "" {
+		return err
+	}
+
+	if desc.Size > c.chunkSize {
+		if location, err = c.uploadChunks(location, file, desc.Size); err != nil {
+			return err
+		}
+		return c.finishUpload(location, desc.Digest, nil, 0)
+	}
+	return c.finishUpload(location, desc.Digest, func() (io.ReadCloser, error) {
+		return os.Open(file)
+	}, desc.Size)
+}
+
+// uploadChunks sends the blob in chunkSize pieces with PATCH requests and
+// returns the location to complete the upload at.
+func (c *registryClient) uploadChunks(location string, file string, size int64) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for offset := int64(0); offset < size; offset += c.chunkSize {
+		n := c.chunkSize
+		if size-offset < n {
+			n = size - offset
+		}
+		header := http.Header{}
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-Length", fmt.Sprintf("%d", n))
+		header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+n-1))
+		start := offset
+		resp, err := c.do("PATCH", location, header, func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(io.NewSectionReader(f, start, n)), nil
+		})
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			return "", registryError(resp, "uploading chunk")
+		}
+		if location, err = c.location(resp); err != nil {
+			return "", err
+		}
+	}
+	return location, nil
+}
+
+func (c *registryClient) finishUpload(location string, digest string, body func() (io.ReadCloser, error), size int64) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Length", fmt.Sprintf("%d", size))
+	resp, err := c.do("PUT", withDigest(location, digest), header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return registryError(resp, "uploading blob "+digest)
+	}
+	return nil
+}
+
+// pushManifest uploads a manifest under the given tag or digest.
+func (c *registryClient) pushManifest(reference string, mediaType string, data []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	header.Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	resp, err := c.do("PUT", c.url("%s/manifests/%s", c.repo, reference), header, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return registryError(resp, "uploading manifest")
+	}
+	return nil
+}
+
+// pushImage uploads the image or image index that desc points to in
+// layout to the push destination ref, which tagImageNames has tagged.
+func pushImage(layout *imageLayout, desc descriptor, ref string, opts Options) error {
+	r, err := parseReference(ref)
+	if err != nil {
+		return err
+	}
+	host, repo, tag := r.registry(), r.repository(), r.tag
+	c := newRegistryClient(host, repo, opts)
+
+	if isIndexMediaType(desc.MediaType) {
+		data, err := ioutil.ReadFile(layout.blobPath(desc.Digest))
+		if err != nil {
+			return err
+		}
+		var index imageIndex
+		if err := json.Unmarshal(data, &index); err != nil {
+			return err
+		}
+		for _, m := range index.Manifests {
+			if err := c.pushImageManifest(layout, m, m.Digest); err != nil {
+				return err
+			}
+		}
+		if err := c.pushManifest(tag, desc.MediaType, data); err != nil {
+			return err
+		}
+	} else if err := c.pushImageManifest(layout, desc, tag); err != nil {
+		return err
+	}
+	logrus.Infof("Pushed %s/%s:%s (%s).", host, repo, tag, desc.Digest)
+	return nil
+}
+
+// pushImageManifest uploads the blobs of an image manifest, then the
+// manifest itself under reference.
+func (c *registryClient) pushImageManifest(layout *imageLayout, desc descriptor, reference string) error {
+	data, err := ioutil.ReadFile(layout.blobPath(desc.Digest))
+	if err != nil {
+		return err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	for _, blob := range append(m.Layers, m.Config) {
+		logrus.Debugf("Pushing blob %s (%d bytes)", blob.Digest, blob.Size)
+		if err := c.pushBlob(blob, layout.blobPath(blob.Digest)); err != nil {
+			return err
+		}
+	}
+	return c.pushManifest(reference, desc.MediaType, data)
+}
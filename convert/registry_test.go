@@ -0,0 +1,419 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry is an in-memory registry implementing the parts of the
+// Docker Registry HTTP API v2 that pushing uses.
+type fakeRegistry struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu sync.Mutex
+	// blobs holds the blobs of every repository by digest.
+	blobs     map[string]map[string][]byte
+	uploads   map[string][]byte
+	manifests map[string][]byte
+	// requests logs every authorized API request as "METHOD path?query".
+	requests []string
+
+	// token, when set, is the bearer token every API request must carry.
+	token string
+	// tokenStatus replaces the answer of the token endpoint when set.
+	tokenStatus int
+	// scopes are the scopes the token was requested for.
+	scopes []string
+}
+
+var (
+	uploadsRoute  = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/$`)
+	uploadRoute   = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/([0-9]+)$`)
+	blobRoute     = regexp.MustCompile(`^/v2/(.+)/blobs/(sha256:[0-9a-f]{64})$`)
+	manifestRoute = regexp.MustCompile(`^/v2/(.+)/manifests/([^/]+)$`)
+)
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{
+		t:         t,
+		blobs:     make(map[string]map[string][]byte),
+		uploads:   make(map[string][]byte),
+		manifests: make(map[string][]byte),
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+// host returns the host:port of the registry, which the client reaches
+// over HTTP because it is local.
+func (r *fakeRegistry) host() string {
+	return strings.TrimPrefix(r.server.URL, "http://")
+}
+
+func (r *fakeRegistry) putBlob(repo string, data []byte) string {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if r.blobs[repo] == nil {
+		r.blobs[repo] = make(map[string][]byte)
+	}
+	r.blobs[repo][digest] = data
+	return digest
+}
+
+// count returns how many requests matched method and contained substr.
+func (r *fakeRegistry) count(method, substr string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, req := range r.requests {
+		if strings.HasPrefix(req, method+" ") && strings.Contains(req, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.URL.Path == "/token" {
+		if r.tokenStatus != 0 {
+			w.WriteHeader(r.tokenStatus)
+			return
+		}
+		r.scopes = req.URL.Query()["scope"]
+		json.NewEncoder(w).Encode(map[string]string{"token": r.token})
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.requests = append(r.requests, req.Method+" "+req.URL.RequestURI())
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		r.t.Errorf("reading request body: %v", err)
+	}
+	q := req.URL.Query()
+	switch {
+	case req.Method == "POST" && uploadsRoute.MatchString(req.URL.Path):
+		repo := uploadsRoute.FindStringSubmatch(req.URL.Path)[1]
+		if digest, from := q.Get("mount"), q.Get("from"); digest != "" {
+			if data, ok := r.blobs[from][digest]; ok {
+				r.putBlob(repo, data)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		id := fmt.Sprint(len(r.requests))
+		r.uploads[id] = nil
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.WriteHeader(http.StatusAccepted)
+
+	case req.Method == "PATCH" && uploadRoute.MatchString(req.URL.Path):
+		id := uploadRoute.FindStringSubmatch(req.URL.Path)[2]
+		want := fmt.Sprintf("%d-%d", len(r.uploads[id]), len(r.uploads[id])+len(body)-1)
+		if got := req.Header.Get("Content-Range"); got != want {
+			http.Error(w, fmt.Sprintf("Content-Range %q, want %q", got, want), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		r.uploads[id] = append(r.uploads[id], body...)
+		w.Header().Set("Location", req.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+
+	case req.Method == "PUT" && uploadRoute.MatchString(req.URL.Path):
+		m := uploadRoute.FindStringSubmatch(req.URL.Path)
+		data, ok := r.uploads[m[2]]
+		if !ok {
+			http.Error(w, "unknown upload", http.StatusNotFound)
+			return
+		}
+		data = append(data, body...)
+		delete(r.uploads, m[2])
+		if digest := r.putBlob(m[1], data); digest != q.Get("digest") {
+			delete(r.blobs[m[1]], digest)
+			http.Error(w, "digest mismatch", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+
+	case req.Method == "HEAD" && blobRoute.MatchString(req.URL.Path):
+		m := blobRoute.FindStringSubmatch(req.URL.Path)
+		if _, ok := r.blobs[m[1]][m[2]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+
+	case req.Method == "PUT" && manifestRoute.MatchString(req.URL.Path):
+		m := manifestRoute.FindStringSubmatch(req.URL.Path)
+		var mf manifest
+		if err := json.Unmarshal(body, &mf); err != nil {
+			http.Error(w, "invalid manifest", http.StatusBadRequest)
+			return
+		}
+		for _, d := range append(mf.Layers, mf.Config) {
+			if _, ok := r.blobs[m[1]][d.Digest]; !ok && d.Digest != "" {
+				http.Error(w, "blob unknown: "+d.Digest, http.StatusBadRequest)
+				return
+			}
+		}
+		if req.Header.Get("Content-Type") != mf.MediaType {
+			http.Error(w, "wrong content type "+req.Header.Get("Content-Type"), http.StatusBadRequest)
+			return
+		}
+		r.manifests[m[1]+":"+m[2]] = body
+		w.WriteHeader(http.StatusCreated)
+
+	default:
+		http.Error(w, "unexpected request", http.StatusMethodNotAllowed)
+	}
+}
+
+// testImage writes an image with a single layer to a new image layout and
+// returns the layout, the manifest descriptor and the layer.
+func testImage(t *testing.T, layer []byte) (*imageLayout, descriptor, []byte) {
+	dir, err := ioutil.TempDir("", "oci2docker-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := newImageLayout(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(layer)
+	if err := ioutil.WriteFile(filepath.Join(layout.blobDir(), fmt.Sprintf("%x", sum)), layer, 0644); err != nil {
+		t.Fatal(err)
+	}
+	layerDesc := descriptor{MediaType: mediaTypeDockerLayer, Digest: fmt.Sprintf("sha256:%x", sum), Size: int64(len(layer))}
+	configDesc, err := layout.putJSON(mediaTypeDockerConfig, imageConfig{Architecture: "amd64", OS: "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := layout.putJSON(mediaTypeDockerManifest, manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeDockerManifest,
+		Config:        configDesc,
+		Layers:        []descriptor{layerDesc},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layout, desc, layer
+}
+
+// withoutDockerConfig points DOCKER_CONFIG at an empty directory so that
+// no stored credentials are used.
+func withoutDockerConfig(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "oci2docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, set := os.LookupEnv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	return func() {
+		if set {
+			os.Setenv("DOCKER_CONFIG", old)
+		} else {
+			os.Unsetenv("DOCKER_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPushImage(t *testing.T) {
+	defer withoutDockerConfig(t)()
+	layerData := []byte("layer contents")
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layerData))
+
+	tests := []struct {
+		name  string
+		setup func(r *fakeRegistry)
+		opts  Options
+		// uploads and mounts are the numbers of blob uploads and mount
+		// attempts expected.
+		uploads int
+		mounts  int
+		err     string
+	}{
+		{
+			name:    "upload",
+			uploads: 2,
+		},
+		{
+			name:    "existing blob",
+			setup:   func(r *fakeRegistry) { r.putBlob("cts/hello", layerData) },
+			uploads: 1,
+		},
+		{
+			name:    "mount",
+			setup:   func(r *fakeRegistry) { r.putBlob("cts/base", layerData) },
+			opts:    Options{MountFrom: []string{"cts/base"}},
+			uploads: 1,
+			mounts:  2,
+		},
+		{
+			name:    "mount missing",
+			opts:    Options{MountFrom: []string{"cts/base"}},
+			uploads: 2,
+			mounts:  2,
+		},
+		{
+			name:    "bearer token",
+			setup:   func(r *fakeRegistry) { r.token = "secret" },
+			uploads: 2,
+		},
+		{
+			name: "token refused",
+			setup: func(r *fakeRegistry) {
+				r.token = "secret"
+				r.tokenStatus = http.StatusForbidden
+			},
+			err: "token request failed: 403 Forbidden",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeRegistry(t)
+			defer r.server.Close()
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			layout, desc, _ := testImage(t, layerData)
+			defer os.RemoveAll(layout.dir)
+
+			err := pushImage(layout, desc, r.host()+"/cts/hello:1.0", tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := r.manifests["cts/hello:1.0"]; !ok {
+				t.Errorf("manifest was not pushed as cts/hello:1.0")
+			}
+			if _, ok := r.blobs["cts/hello"][layerDigest]; !ok {
+				t.Errorf("layer %s missing from cts/hello", layerDigest)
+			}
+			if got := r.count("PUT", "/blobs/uploads/"); got != tt.uploads {
+				t.Errorf("got %d blob uploads, want %d", got, tt.uploads)
+			}
+			if got := r.count("HEAD", "/blobs/"); got != 2 {
+				t.Errorf("got %d blob checks, want 2", got)
+			}
+			if got := r.count("POST", "mount="); got != tt.mounts {
+				t.Errorf("got %d mount requests, want %d", got, tt.mounts)
+			}
+			if r.token != "" {
+				want := []string{"repository:cts/hello:pull,push"}
+				if fmt.Sprint(r.scopes) != fmt.Sprint(want) {
+					t.Errorf("token scopes %v, want %v", r.scopes, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPushBlobChunked(t *testing.T) {
+	defer withoutDockerConfig(t)()
+	tests := []struct {
+		name   string
+		data   string
+		digest string
+		chunks int
+		err    string
+	}{
+		{name: "several chunks", data: "0123456789", chunks: 3},
+		{name: "exact chunks", data: "01234567", chunks: 2},
+		{name: "single put", data: "0123", chunks: 0},
+		{name: "digest mismatch", data: "0123456789", digest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other"))), err: "400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newFakeRegistry(t)
+			defer r.server.Close()
+			f, err := ioutil.TempFile("", "oci2docker-blob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			f.WriteString(tt.data)
+			f.Close()
+
+			digest := tt.digest
+			if digest == "" {
+				digest = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(tt.data)))
+			}
+			c := newRegistryClient(r.host(), "cts/hello", Options{})
+			c.chunkSize = 4
+			err = c.pushBlob(descriptor{Digest: digest, Size: int64(len(tt.data))}, f.Name())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				if len(r.blobs["cts/hello"]) != 0 {
+					t.Errorf("registry kept a blob with a mismatching digest")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(r.blobs["cts/hello"][digest]); got != tt.data {
+				t.Errorf("registry has %q, want %q", got, tt.data)
+			}
+			if got := r.count("PATCH", "/blobs/uploads/"); got != tt.chunks {
+				t.Errorf("got %d chunks, want %d", got, tt.chunks)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		username  string
+		want      string
+		err       string
+	}{
+		{name: "basic", challenge: `Basic realm="registry"`, username: "user", want: "Basic dXNlcjpwYXNz"},
+		{name: "basic without credentials", challenge: `Basic realm="registry"`, err: "requires credentials"},
+		{name: "bearer without realm", challenge: `Bearer service="registry"`, err: "invalid token realm"},
+		{name: "unknown scheme", challenge: `Negotiate`, err: "unsupported authentication challenge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &registryClient{host: "registry.example", repo: "cts/hello", client: &http.Client{}}
+			if tt.username != "" {
+				c.username, c.password = tt.username, "pass"
+			}
+			err := c.authorize(tt.challenge)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.authorization != tt.want {
+				t.Errorf("got authorization %q, want %q", c.authorization, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// weightDevice is the block IO weight of a host device.
+type weightDevice struct {
+	Path   string
+	Weight uint16
+}
+
+// throttleDevice is a block IO rate limit on a host device.
+type throttleDevice struct {
+	Path string
+	Rate uint64
+}
+
+// mapResources maps the cgroup settings of the bundle. Docker names block
+// devices by path, so the device numbers of the bundle are looked up on
+// the current host.
+func (rc *runtimeConfig) mapResources(r *specs.Resources) {
+	if m := r.Memory; m != nil {
+		rc.Memory = int64Value(m.Limit)
+		rc.MemoryReservation = int64Value(m.Reservation)
+		rc.MemorySwap = int64Value(m.Swap)
+		rc.KernelMemory = int64Value(m.Kernel)
+		// A swappiness of 0 avoids swapping, so only a missing one is
+		// left to Docker.
+		if m.Swappiness != nil {
+			swappiness := int64(*m.Swappiness)
+			rc.MemorySwappiness = &swappiness
+		}
+		if tcp := int64Value(m.KernelTCP); tcp != 0 {
+			rc.unsupported("kernel TCP memory limit %d", tcp)
+		}
+	}
+	if c := r.CPU; c != nil {
+		rc.CPUShares = int64Value(c.Shares)
+		rc.CPUQuota = int64Value(c.Quota)
+		rc.CPUPeriod = int64Value(c.Period)
+		rc.CPURealtimeRuntime = int64Value(c.RealtimeRuntime)
+		rc.CPURealtimePeriod = int64Value(c.RealtimePeriod)
+		if c.Cpus != nil {
+			rc.CpusetCpus = *c.Cpus
+		}
+		if c.Mems != nil {
+			rc.CpusetMems = *c.Mems
+		}
+	}
+	if r.Pids != nil && r.Pids.Limit != nil {
+		rc.PidsLimit = *r.Pids.Limit
+	}
+	if r.DisableOOMKiller != nil {
+		rc.OomKillDisable = *r.DisableOOMKiller
+	}
+	if r.OOMScoreAdj != nil {
+		rc.OomScoreAdj = *r.OOMScoreAdj
+	}
+	if b := r.BlockIO; b != nil {
+		rc.mapBlockIO(b)
+	}
+	for _, h := range r.HugepageLimits {
+		if h.Pagesize != nil && h.Limit != nil {
+			rc.unsupported("hugepage limit %d for %s pages", *h.Limit, *h.Pagesize)
+		}
+	}
+	if n := r.Network; n != nil {
+		if n.ClassID != nil {
+			rc.unsupported("network class ID %d", *n.ClassID)
+		}
+		for _, p := range n.Priorities {
+			rc.unsupported("network priority %d on %s", p.Priority, p.Name)
+		}
+	}
+}
+
+func (rc *runtimeConfig) mapBlockIO(b *specs.BlockIO) {
+	if b.Weight != nil {
+		rc.BlkioWeight = *b.Weight
+	}
+	if b.LeafWeight != nil {
+		rc.unsupported("block IO leaf weight %d", *b.LeafWeight)
+	}
+	for _, d := range b.WeightDevice {
+		if d.LeafWeight != nil {
+			rc.unsupported("block IO leaf weight %d of device %d:%d", *d.LeafWeight, d.Major, d.Minor)
+		}
+		if d.Weight == nil {
+			continue
+		}
+		path, ok := hostDevicePath('b', d.Major, d.Minor)
+		if !ok {
+			rc.unsupported("block IO weight of device %d:%d, which is not on this host", d.Major, d.Minor)
+			continue
+		}
+		rc.BlkioWeightDevice = append(rc.BlkioWeightDevice, weightDevice{Path: path, Weight: *d.Weight})
+	}
+	for _, t := range []struct {
+		name    string
+		devices []specs.ThrottleDevice
+		mapped  *[]throttleDevice
+	}{
+		{"read bps", b.ThrottleReadBpsDevice, &rc.BlkioDeviceReadBps},
+		{"write bps", b.ThrottleWriteBpsDevice, &rc.BlkioDeviceWriteBps},
+		{"read IOPS", b.ThrottleReadIOPSDevice, &rc.BlkioDeviceReadIOps},
+		{"write IOPS", b.ThrottleWriteIOPSDevice, &rc.BlkioDeviceWriteIOps},
+	} {
+		for _, d := range t.devices {
+			if d.Rate == nil {
+				continue
+			}
+			path, ok := hostDevicePath('b', d.Major, d.Minor)
+			if !ok {
+				rc.unsupported("%s limit of device %d:%d, which is not on this host", t.name, d.Major, d.Minor)
+				continue
+			}
+			*t.mapped = append(*t.mapped, throttleDevice{Path: path, Rate: *d.Rate})
+		}
+	}
+}
+
+// hostDevicePath finds the device node of a character ('c') or block ('b')
+// device on the current host, first through sysfs, then by scanning /dev.
+func hostDevicePath(typ byte, major, minor int64) (string, bool) {
+	class := "char"
+	if typ == 'b' {
+		class = "block"
+	}
+	uevent := fmt.Sprintf("/sys/dev/%s/%d:%d/uevent", class, major, minor)
+	if f, err := os.Open(uevent); err == nil {
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			if name := strings.TrimPrefix(s.Text(), "DEVNAME="); name != s.Text() {
+				path := "/dev/" + name
+				if isDeviceNode(path, typ, major, minor) {
+					return path, true
+				}
+			}
+		}
+	}
+
+	var found string
+	filepath.Walk("/dev", func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if found != "" {
+			return filepath.SkipDir
+		}
+		if fi.Mode()&os.ModeDevice != 0 && isDeviceNode(path, typ, major, minor) {
+			found = path
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found, found != ""
+}
+
+// isDeviceNode reports whether path is the device node with the given type
+// and numbers.
+func isDeviceNode(path string, typ byte, major, minor int64) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeDevice == 0 {
+		return false
+	}
+	if (fi.Mode()&os.ModeCharDevice != 0) != (typ == 'c') {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	rdev := uint64(st.Rdev)
+	return int64((rdev>>8)&0xfff|(rdev>>32)&^0xfff) == major &&
+		int64(rdev&0xff|(rdev>>12)&^0xff) == minor
+}
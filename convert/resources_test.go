@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func u64(v uint64) *uint64 { return &v }
+
+func TestMapResources(t *testing.T) {
+	swappiness := int64(0)
+	cpus, mems, pageSize := "0-3", "0", "2MB"
+	pids, oomScoreAdj, disableOOM := int64(100), -500, true
+	weight, leafWeight := uint16(300), uint16(200)
+	classID := uint32(0x100001)
+	tests := []struct {
+		name        string
+		r           specs.Resources
+		want        runtimeConfig
+		unsupported []string
+	}{
+		{name: "empty"},
+		{
+			name: "memory",
+			r: specs.Resources{Memory: &specs.Memory{
+				Limit:       u64(1 << 30),
+				Reservation: u64(512 << 20),
+				Swap:        u64(2 << 30),
+				Swappiness:  u64(0),
+				KernelTCP:   u64(1 << 20),
+			}},
+			want: runtimeConfig{
+				Memory:            1 << 30,
+				MemoryReservation: 512 << 20,
+				MemorySwap:        2 << 30,
+				MemorySwappiness:  &swappiness,
+			},
+			unsupported: []string{"kernel TCP memory limit 1048576"},
+		},
+		{
+			name: "cpu and pids",
+			r: specs.Resources{
+				CPU: &specs.CPU{
+					Shares: u64(512),
+					Quota:  u64(50000),
+					Period: u64(100000),
+					Cpus:   &cpus,
+					Mems:   &mems,
+				},
+				Pids:             &specs.Pids{Limit: &pids},
+				DisableOOMKiller: &disableOOM,
+				OOMScoreAdj:      &oomScoreAdj,
+			},
+			want: runtimeConfig{
+				CPUShares:      512,
+				CPUQuota:       50000,
+				CPUPeriod:      100000,
+				CpusetCpus:     "0-3",
+				CpusetMems:     "0",
+				PidsLimit:      100,
+				OomKillDisable: true,
+				OomScoreAdj:    -500,
+			},
+		},
+		{
+			name: "block IO",
+			r: specs.Resources{BlockIO: &specs.BlockIO{
+				Weight:     &weight,
+				LeafWeight: &leafWeight,
+				WeightDevice: []specs.WeightDevice{
+					{Weight: &weight},
+					{LeafWeight: &leafWeight},
+				},
+				ThrottleReadBpsDevice:   []specs.ThrottleDevice{{Rate: u64(1 << 20)}},
+				ThrottleWriteIOPSDevice: []specs.ThrottleDevice{{}},
+			}},
+			want: runtimeConfig{BlkioWeight: 300},
+			unsupported: []string{
+				"block IO leaf weight 200",
+				"block IO weight of device 0:0, which is not on this host",
+				"block IO leaf weight 200 of device 0:0",
+				"read bps limit of device 0:0, which is not on this host",
+			},
+		},
+		{
+			name: "hugepages and network",
+			r: specs.Resources{
+				HugepageLimits: []specs.HugepageLimit{{Pagesize: &pageSize, Limit: u64(1 << 30)}, {Pagesize: &pageSize}},
+				Network: &specs.Network{
+					ClassID:    &classID,
+					Priorities: []specs.InterfacePriority{{Name: "eth0", Priority: 5}},
+				},
+			},
+			unsupported: []string{
+				"hugepage limit 1073741824 for 2MB pages",
+				"network class ID 1048577",
+				"network priority 5 on eth0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		rc := &runtimeConfig{}
+		rc.mapResources(&tt.r)
+		got := *rc
+		got.Unsupported = nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+			t.Errorf("%s: got unsupported %q, want %q", tt.name, rc.Unsupported, tt.unsupported)
+		}
+	}
+}
+
+func TestHostDevicePath(t *testing.T) {
+	tests := []struct {
+		typ          byte
+		major, minor int64
+		want         string
+	}{
+		{'c', 1, 3, "/dev/null"},
+		{'c', 1, 5, "/dev/zero"},
+		{'b', 1, 3, ""},
+		{'c', 4095, 4095, ""},
+	}
+	for _, tt := range tests {
+		got, ok := hostDevicePath(tt.typ, tt.major, tt.minor)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("hostDevicePath(%c, %d, %d) = %q, %v, want %q", tt.typ, tt.major, tt.minor, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// rlimInfinity is RLIM_INFINITY, an unlimited resource.
+const rlimInfinity = math.MaxUint64
+
+// dockerUlimits maps the resource limits, without their RLIMIT_ prefix, to
+// the names Docker gives them.
+var dockerUlimits = map[string]string{
+	"AS":         "as",
+	"CORE":       "core",
+	"CPU":        "cpu",
+	"DATA":       "data",
+	"FSIZE":      "fsize",
+	"LOCKS":      "locks",
+	"MEMLOCK":    "memlock",
+	"MSGQUEUE":   "msgqueue",
+	"NICE":       "nice",
+	"NOFILE":     "nofile",
+	"NPROC":      "nproc",
+	"RSS":        "rss",
+	"RTPRIO":     "rtprio",
+	"RTTIME":     "rttime",
+	"SIGPENDING": "sigpending",
+	"STACK":      "stack",
+}
+
+// mapRlimits maps process.rlimits to ulimits. Unlimited values become -1,
+// which Docker reads as unlimited.
+func (rc *runtimeConfig) mapRlimits(rlimits []specs.Rlimit) error {
+	seen := make(map[string]bool)
+	for _, r := range rlimits {
+		name, ok := dockerUlimits[strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(r.Type)), "RLIMIT_")]
+		if !ok {
+			return fmt.Errorf("unknown rlimit type %q", r.Type)
+		}
+		if seen[name] {
+			return fmt.Errorf("rlimit %s is set more than once", r.Type)
+		}
+		seen[name] = true
+		soft, err := ulimitValue(r.Type, "soft", r.Soft)
+		if err != nil {
+			return err
+		}
+		hard, err := ulimitValue(r.Type, "hard", r.Hard)
+		if err != nil {
+			return err
+		}
+		if r.Soft > r.Hard {
+			return fmt.Errorf("rlimit %s: soft limit %s exceeds hard limit %s", r.Type, rlimitString(r.Soft), rlimitString(r.Hard))
+		}
+		rc.Ulimits = append(rc.Ulimits, ulimit{Name: name, Soft: soft, Hard: hard})
+	}
+	return nil
+}
+
+// ulimitValue converts a limit of an rlimit to the signed value of a
+// ulimit.
+func ulimitValue(typ, which string, v uint64) (int64, error) {
+	switch {
+	case v == rlimInfinity:
+		return -1, nil
+	case v > math.MaxInt64:
+		return 0, fmt.Errorf("rlimit %s: %s limit %d is out of range", typ, which, v)
+	}
+	return int64(v), nil
+}
+
+func rlimitString(v uint64) string {
+	if v == rlimInfinity {
+		return "unlimited"
+	}
+	return fmt.Sprint(v)
+}
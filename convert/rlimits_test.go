@@ -0,0 +1,98 @@
+package convert
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestMapRlimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		rlimits []specs.Rlimit
+		want    []ulimit
+		err     string
+	}{
+		{name: "none"},
+		{
+			name: "names",
+			rlimits: []specs.Rlimit{
+				{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 4096},
+				{Type: "rlimit_nproc", Soft: 100, Hard: 100},
+				{Type: " CORE ", Soft: 0, Hard: 0},
+			},
+			want: []ulimit{
+				{Name: "nofile", Soft: 1024, Hard: 4096},
+				{Name: "nproc", Soft: 100, Hard: 100},
+				{Name: "core", Soft: 0, Hard: 0},
+			},
+		},
+		{
+			name: "unlimited",
+			rlimits: []specs.Rlimit{
+				{Type: "RLIMIT_MEMLOCK", Soft: 65536, Hard: rlimInfinity},
+				{Type: "RLIMIT_STACK", Soft: rlimInfinity, Hard: rlimInfinity},
+				{Type: "RLIMIT_FSIZE", Soft: math.MaxInt64, Hard: math.MaxInt64},
+			},
+			want: []ulimit{
+				{Name: "memlock", Soft: 65536, Hard: -1},
+				{Name: "stack", Soft: -1, Hard: -1},
+				{Name: "fsize", Soft: math.MaxInt64, Hard: math.MaxInt64},
+			},
+		},
+		{
+			name:    "unknown type",
+			rlimits: []specs.Rlimit{{Type: "RLIMIT_FOO", Soft: 1, Hard: 1}},
+			err:     `unknown rlimit type "RLIMIT_FOO"`,
+		},
+		{
+			name:    "empty type",
+			rlimits: []specs.Rlimit{{Soft: 1, Hard: 1}},
+			err:     `unknown rlimit type ""`,
+		},
+		{
+			name: "set twice",
+			rlimits: []specs.Rlimit{
+				{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+				{Type: "nofile", Soft: 2048, Hard: 2048},
+			},
+			err: "rlimit nofile is set more than once",
+		},
+		{
+			name:    "soft above hard",
+			rlimits: []specs.Rlimit{{Type: "RLIMIT_NOFILE", Soft: 4096, Hard: 1024}},
+			err:     "rlimit RLIMIT_NOFILE: soft limit 4096 exceeds hard limit 1024",
+		},
+		{
+			name:    "unlimited soft above hard",
+			rlimits: []specs.Rlimit{{Type: "RLIMIT_CPU", Soft: rlimInfinity, Hard: 60}},
+			err:     "rlimit RLIMIT_CPU: soft limit unlimited exceeds hard limit 60",
+		},
+		{
+			name:    "out of range",
+			rlimits: []specs.Rlimit{{Type: "RLIMIT_AS", Soft: 1, Hard: math.MaxInt64 + 1}},
+			err:     "rlimit RLIMIT_AS: hard limit 9223372036854775808 is out of range",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &runtimeConfig{}
+			err := rc.mapRlimits(tt.rlimits)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rc.Ulimits, tt.want) {
+				t.Errorf("got ulimits %+v, want %+v", rc.Ulimits, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package convert
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+const (
+	// headSize is how much of each executable the rootfs index keeps, enough
+	// for ELF and program headers or a shebang line.
+	headSize = 4096
+	// maxSymlinks bounds symlink resolution, like the kernel's ELOOP limit.
+	maxSymlinks = 40
+)
+
+// rootfsEntry is one file of the rootfs index.
+type rootfsEntry struct {
+	hdr *tar.Header
+	// head holds the first bytes of regular files with an execute bit.
+	head []byte
+}
+
+func (e *rootfsEntry) isDir() bool {
+	return e.hdr.Typeflag == tar.TypeDir
+}
+
+func (e *rootfsEntry) isSymlink() bool {
+	return e.hdr.Typeflag == tar.TypeSymlink
+}
+
+func (e *rootfsEntry) isExecutable() bool {
+	return e.hdr.Mode&0111 != 0
+}
+
+// rootfsIndex is a metadata snapshot of the rootfs, read in one pass from
+// the bundle directory or archive, used to check the rootfs without
+// extracting it.
+type rootfsIndex struct {
+	entries map[string]*rootfsEntry
+	// names lists the entries in archive order.
+	names []string
+}
+
+// indexRootfs reads the rootfs a archives, leaving out excluded files.
+// Owners are mapped the same way as in written layers.
+func (a *archiver) indexRootfs() (*rootfsIndex, error) {
+	idx := &rootfsIndex{entries: make(map[string]*rootfsEntry)}
+	err := a.walk(func(hdr *tar.Header, body io.Reader) error {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		a.mapOwner(hdr)
+		e := &rootfsEntry{hdr: hdr}
+		if hdr.Typeflag == tar.TypeLink {
+			if target, ok := idx.entries[hdr.Linkname]; ok {
+				e.head = target.head
+			}
+		}
+		if body != nil && e.isExecutable() {
+			e.head = make([]byte, headSize)
+			n, err := io.ReadFull(body, e.head)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			e.head = e.head[:n]
+		}
+		idx.entries[name] = e
+		idx.names = append(idx.names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// checkRootfs inspects the rootfs a archives against the configuration of
+// the bundle at path before any image is produced.
+func checkRootfs(path string, a *archiver) error {
+	spec := getConfigSpec(path)
+	if spec == nil {
+		return ErrNoConfig
+	}
+	idx, err := a.indexRootfs()
+	if err != nil {
+		return fmt.Errorf("reading the rootfs: %v", err)
+	}
+	return checkRootfsIndex(spec, idx)
+}
+
+// checkRootfsIndex runs the rootfs checks on an index already read.
+func checkRootfsIndex(spec *specs.Spec, idx *rootfsIndex) error {
+	entrypoint, err := checkEntrypoint(spec, idx)
+	if err != nil {
+		return err
+	}
+	return checkArchitecture(spec, idx, entrypoint)
+}
+
+// resolve follows symlinks in the absolute path p the way the kernel would inside the
+// container, never leaving the rootfs. It returns the resolved path and
+// its entry, or an error naming the component that does not exist.
+func (idx *rootfsIndex) resolve(p string) (string, *rootfsEntry, error) {
+	parts := splitPath(p)
+	cur := ""
+	hops := 0
+	for i := 0; i < len(parts); i++ {
+		next := path.Join(cur, parts[i])
+		e, ok := idx.entries[next]
+		if !ok {
+			if i < len(parts)-1 && idx.hasChildren(next) {
+				cur = next
+				continue
+			}
+			return "/" + next, nil, fmt.Errorf("%s does not exist in the rootfs", "/"+next)
+		}
+		if e.isSymlink() {
+			if hops++; hops > maxSymlinks {
+				return "/" + next, nil, fmt.Errorf("too many levels of symbolic links at %s", "/"+next)
+			}
+			base := cur
+			if path.IsAbs(e.hdr.Linkname) {
+				base = ""
+			}
+			rest := append([]string{"/", base, e.hdr.Linkname}, parts[i+1:]...)
+			parts = splitPath(path.Join(rest...))
+			cur, i = "", -1
+			continue
+		}
+		if i < len(parts)-1 && !e.isDir() {
+			return "/" + next, nil, fmt.Errorf("%s is not a directory", "/"+next)
+		}
+		cur = next
+	}
+	if cur == "" {
+		return "/", nil, fmt.Errorf("/ is a directory")
+	}
+	return "/" + cur, idx.entries[cur], nil
+}
+
+// stat is the rootfsStat of the indexed rootfs.
+func (idx *rootfsIndex) stat(p string) (bool, error) {
+	resolved, e, err := idx.resolve(p)
+	if err != nil {
+		if idx.hasChildren(strings.TrimPrefix(resolved, "/")) {
+			return true, nil
+		}
+		return false, err
+	}
+	return e.isDir(), nil
+}
+
+// hasChildren reports whether dir is implied by the entries below it, for
+// archives that do not list every directory.
+func (idx *rootfsIndex) hasChildren(dir string) bool {
+	prefix := dir + "/"
+	for _, name := range idx.names {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookPath finds an executable in the rootfs like a shell would: names
+// containing a slash are used as they are, others are searched in the
+// directories of PATH. Relative paths are relative to cwd.
+func (idx *rootfsIndex) lookPath(name, pathEnv, cwd string) (string, *rootfsEntry, error) {
+	if path.IsAbs(name) {
+		return idx.resolve(name)
+	}
+	if strings.Contains(name, "/") {
+		return idx.resolve(path.Join("/", cwd, name))
+	}
+	for _, dir := range strings.Split(pathEnv, ":") {
+		if !path.IsAbs(dir) {
+			dir = path.Join("/", cwd, dir)
+		}
+		p, e, err := idx.resolve(path.Join(dir, name))
+		if err == nil && !e.isDir() {
+			return p, e, nil
+		}
+	}
+	return "", nil, fmt.Errorf("%s not found in PATH %q", name, pathEnv)
+}
+
+// executables returns the paths of regular executable files, sorted.
+func (idx *rootfsIndex) executables() []string {
+	var names []string
+	for name, e := range idx.entries {
+		if (e.hdr.Typeflag == tar.TypeReg || e.hdr.Typeflag == tar.TypeRegA) && e.isExecutable() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func splitPath(p string) []string {
+	var parts []string
+	for _, part := range strings.Split(path.Clean("/"+p), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// envValue returns the value of key in a KEY=value environment list.
+func envValue(env []string, key string) (string, bool) {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return kv[len(key)+1:], true
+		}
+	}
+	return "", false
+}
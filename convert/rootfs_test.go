@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"archive/tar"
+	"strings"
+	"testing"
+)
+
+// testEntry describes a file of a rootfs index built for tests. Names
+// ending in a slash are directories; link makes a symlink. Files with
+// content get mode 0755 unless mode is set.
+type testEntry struct {
+	name    string
+	link    string
+	content string
+	mode    int64
+	uid     int
+	gid     int
+}
+
+// newTestIndex builds a rootfs index from entries, in order.
+func newTestIndex(entries ...testEntry) *rootfsIndex {
+	idx := &rootfsIndex{entries: make(map[string]*rootfsEntry)}
+	for _, te := range entries {
+		hdr := &tar.Header{Name: te.name, Mode: te.mode, Uid: te.uid, Gid: te.gid, Typeflag: tar.TypeReg}
+		switch {
+		case strings.HasSuffix(te.name, "/"):
+			hdr.Typeflag = tar.TypeDir
+			if hdr.Mode == 0 {
+				hdr.Mode = 0755
+			}
+		case te.link != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, te.link
+			hdr.Mode = 0777
+		case hdr.Mode == 0:
+			hdr.Mode = 0755
+		}
+		name := strings.TrimSuffix(te.name, "/")
+		e := &rootfsEntry{hdr: hdr}
+		if hdr.Typeflag == tar.TypeReg && e.isExecutable() {
+			e.head = []byte(te.content)
+		}
+		idx.entries[name] = e
+		idx.names = append(idx.names, name)
+	}
+	return idx
+}
+
+func TestRootfsIndexResolve(t *testing.T) {
+	idx := newTestIndex(
+		testEntry{name: "bin/"},
+		testEntry{name: "bin/busybox", content: "x"},
+		testEntry{name: "bin/sh", link: "busybox"},
+		testEntry{name: "usr/bin/env", content: "x"},
+		testEntry{name: "sbin", link: "/bin"},
+		testEntry{name: "lib/up", link: "../../.."},
+		testEntry{name: "loop", link: "loop"},
+	)
+	tests := []struct {
+		path string
+		want string
+		err  string
+	}{
+		{path: "/bin/busybox", want: "/bin/busybox"},
+		{path: "/bin/sh", want: "/bin/busybox"},
+		{path: "/sbin/sh", want: "/bin/busybox"},
+		{path: "/usr/bin/env", want: "/usr/bin/env"},
+		{path: "/lib/up/bin/sh", want: "/bin/busybox"},
+		{path: "/bin", want: "/bin"},
+		{path: "/", err: "/ is a directory"},
+		{path: "/bin/bash", err: "/bin/bash does not exist in the rootfs"},
+		{path: "/bin/busybox/sh", err: "/bin/busybox is not a directory"},
+		{path: "/loop", err: "too many levels of symbolic links at /loop"},
+	}
+	for _, tt := range tests {
+		got, _, err := idx.resolve(tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolve(%q): got error %v, want %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("resolve(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestRootfsIndexLookPath(t *testing.T) {
+	idx := newTestIndex(
+		testEntry{name: "bin/sh", content: "x"},
+		testEntry{name: "usr/local/bin/app/"},
+		testEntry{name: "usr/bin/app", content: "x"},
+		testEntry{name: "srv/run.sh", content: "x"},
+	)
+	tests := []struct {
+		name, pathEnv, cwd string
+		want               string
+		err                string
+	}{
+		{name: "sh", pathEnv: "/bin", cwd: "/", want: "/bin/sh"},
+		{name: "app", pathEnv: "/usr/local/bin:/usr/bin", cwd: "/", want: "/usr/bin/app"},
+		{name: "run.sh", pathEnv: "bin:.", cwd: "/srv", want: "/srv/run.sh"},
+		{name: "./run.sh", pathEnv: "", cwd: "/srv", want: "/srv/run.sh"},
+		{name: "/bin/sh", pathEnv: "", cwd: "/srv", want: "/bin/sh"},
+		{name: "bash", pathEnv: "/bin:/usr/bin", cwd: "/", err: `bash not found in PATH "/bin:/usr/bin"`},
+		{name: "run.sh", pathEnv: "/bin", cwd: "/", err: "not found in PATH"},
+	}
+	for _, tt := range tests {
+		got, _, err := idx.lookPath(tt.name, tt.pathEnv, tt.cwd)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("lookPath(%q, %q, %q): got error %v, want %q", tt.name, tt.pathEnv, tt.cwd, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookPath(%q, %q, %q) = %q, %v, want %q", tt.name, tt.pathEnv, tt.cwd, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// runArgs returns the docker run flags that start a container of rc, each
+// written as a single --flag=value argument.
+func runArgs(rc *runtimeConfig) []string {
+	var args []string
+	flag := func(name string, value interface{}) {
+		args = append(args, fmt.Sprintf("--%s=%v", name, value))
+	}
+
+	for _, ns := range []struct {
+		name string
+		mode string
+	}{
+		{"network", rc.NetworkMode},
+		{"pid", rc.PidMode},
+		{"ipc", rc.IpcMode},
+		{"uts", rc.UTSMode},
+		{"userns", rc.UsernsMode},
+		{"cgroupns", rc.CgroupnsMode},
+	} {
+		if ns.mode != "" {
+			flag(ns.name, ns.mode)
+		}
+	}
+	if rc.Hostname != "" {
+		flag("hostname", rc.Hostname)
+	}
+	for _, gid := range rc.User.AdditionalGids {
+		flag("group-add", gid)
+	}
+	if rc.Tty {
+		args = append(args, "--tty", "--interactive")
+	}
+	if rc.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	for _, m := range rc.Mounts {
+		if m.Type == "tmpfs" {
+			tmpfs := m.Target
+			if len(m.Options) > 0 {
+				tmpfs += ":" + strings.Join(m.Options, ",")
+			}
+			flag("tmpfs", tmpfs)
+			continue
+		}
+		mount := "type=" + m.Type
+		if m.Source != "" {
+			mount += ",source=" + m.Source
+		}
+		mount += ",target=" + m.Target
+		if m.ReadOnly {
+			mount += ",readonly"
+		}
+		if m.Propagation != "" {
+			mount += ",bind-propagation=" + m.Propagation
+		}
+		flag("mount", mount)
+	}
+	if rc.ShmSize > 0 {
+		flag("shm-size", rc.ShmSize)
+	}
+	for _, c := range rc.CapAdd {
+		flag("cap-add", c)
+	}
+	for _, c := range rc.CapDrop {
+		flag("cap-drop", c)
+	}
+	for _, o := range rc.securityOpts() {
+		flag("security-opt", o)
+	}
+	for _, u := range rc.Ulimits {
+		flag("ulimit", fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard))
+	}
+	for _, d := range rc.Devices {
+		flag("device", d)
+	}
+	for _, r := range rc.DeviceCgroupRules {
+		flag("device-cgroup-rule", r)
+	}
+	var keys []string
+	for key := range rc.Sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		flag("sysctl", key+"="+rc.Sysctls[key])
+	}
+
+	for _, f := range []struct {
+		name  string
+		value int64
+	}{
+		{"memory", rc.Memory},
+		{"memory-reservation", rc.MemoryReservation},
+		{"memory-swap", rc.MemorySwap},
+		{"kernel-memory", rc.KernelMemory},
+		{"oom-score-adj", int64(rc.OomScoreAdj)},
+		{"cpu-shares", rc.CPUShares},
+		{"cpu-quota", rc.CPUQuota},
+		{"cpu-period", rc.CPUPeriod},
+		{"cpu-rt-runtime", rc.CPURealtimeRuntime},
+		{"cpu-rt-period", rc.CPURealtimePeriod},
+		{"pids-limit", rc.PidsLimit},
+		{"blkio-weight", int64(rc.BlkioWeight)},
+	} {
+		if f.value != 0 {
+			flag(f.name, f.value)
+		}
+	}
+	if rc.MemorySwappiness != nil {
+		flag("memory-swappiness", *rc.MemorySwappiness)
+	}
+	if rc.OomKillDisable {
+		args = append(args, "--oom-kill-disable")
+	}
+	if rc.CpusetCpus != "" {
+		flag("cpuset-cpus", rc.CpusetCpus)
+	}
+	if rc.CpusetMems != "" {
+		flag("cpuset-mems", rc.CpusetMems)
+	}
+	for _, d := range rc.BlkioWeightDevice {
+		flag("blkio-weight-device", fmt.Sprintf("%s:%d", d.Path, d.Weight))
+	}
+	for _, t := range []struct {
+		name    string
+		devices []throttleDevice
+	}{
+		{"device-read-bps", rc.BlkioDeviceReadBps},
+		{"device-write-bps", rc.BlkioDeviceWriteBps},
+		{"device-read-iops", rc.BlkioDeviceReadIOps},
+		{"device-write-iops", rc.BlkioDeviceWriteIOps},
+	} {
+		for _, d := range t.devices {
+			flag(t.name, fmt.Sprintf("%s:%d", d.Path, d.Rate))
+		}
+	}
+	return args
+}
+
+// formatRunCommand writes the docker run command line of rc as a shell
+// command, one flag per line. The process of the bundle replaces the
+// entrypoint and the command of the image.
+func formatRunCommand(rc *runtimeConfig) []byte {
+	args := runArgs(rc)
+	if len(rc.Args) > 0 {
+		args = append(args, "--entrypoint="+rc.Args[0])
+	}
+	words := append([]string{"docker run"}, args...)
+	for i, w := range words[1:] {
+		words[i+1] = shellQuote(w)
+	}
+	image := shellQuote(rc.Image)
+	if len(rc.Args) > 1 {
+		var cmd []string
+		for _, a := range rc.Args[1:] {
+			cmd = append(cmd, shellQuote(a))
+		}
+		image += " " + strings.Join(cmd, " ")
+	}
+	words = append(words, image)
+	return []byte(strings.Join(words, " \\\n  ") + "\n")
+}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=@,+%-]+$`)
+
+// shellQuote quotes s for a POSIX shell when it holds special characters.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
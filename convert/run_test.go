@@ -0,0 +1,145 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestRunArgs(t *testing.T) {
+	swappiness := int64(0)
+	tests := []struct {
+		name string
+		rc   runtimeConfig
+		want []string
+	}{
+		{name: "defaults"},
+		{
+			name: "namespaces and process",
+			rc: runtimeConfig{
+				NetworkMode:  "host",
+				CgroupnsMode: "private",
+				Hostname:     "app",
+				User:         specs.User{AdditionalGids: []uint32{10}},
+				Tty:          true,
+				ReadOnly:     true,
+			},
+			want: []string{"--network=host", "--cgroupns=private", "--hostname=app", "--group-add=10", "--tty", "--interactive", "--read-only"},
+		},
+		{
+			name: "mounts",
+			rc: runtimeConfig{
+				Mounts: []runtimeMount{
+					{Type: "tmpfs", Target: "/tmp", Options: []string{"size=1m"}},
+					{Type: "bind", Source: "/srv", Target: "/data", ReadOnly: true, Propagation: "rshared"},
+					{Type: "volume", Target: "/var/lib/app"},
+				},
+				ShmSize: 1 << 20,
+			},
+			want: []string{
+				"--tmpfs=/tmp:size=1m",
+				"--mount=type=bind,source=/srv,target=/data,readonly,bind-propagation=rshared",
+				"--mount=type=volume,target=/var/lib/app",
+				"--shm-size=1048576",
+			},
+		},
+		{
+			name: "security",
+			rc: runtimeConfig{
+				CapAdd:            []string{"NET_ADMIN"},
+				CapDrop:           []string{"MKNOD"},
+				NoNewPrivileges:   true,
+				Ulimits:           []ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+				Devices:           []deviceMapping{{"/dev/fuse", "/dev/fuse", "rwm"}},
+				DeviceCgroupRules: []string{"c 10:200 rwm"},
+				Sysctls:           map[string]string{"net.ipv4.ip_forward": "1", "kernel.msgmax": "65536"},
+			},
+			want: []string{
+				"--cap-add=NET_ADMIN",
+				"--cap-drop=MKNOD",
+				"--security-opt=no-new-privileges",
+				"--ulimit=nofile=1024:4096",
+				"--device=/dev/fuse:/dev/fuse:rwm",
+				"--device-cgroup-rule=c 10:200 rwm",
+				"--sysctl=kernel.msgmax=65536",
+				"--sysctl=net.ipv4.ip_forward=1",
+			},
+		},
+		{
+			name: "resources",
+			rc: runtimeConfig{
+				Memory:               1 << 30,
+				MemorySwappiness:     &swappiness,
+				OomKillDisable:       true,
+				CPUShares:            512,
+				CpusetCpus:           "0-1",
+				BlkioWeightDevice:    []weightDevice{{Path: "/dev/sda", Weight: 200}},
+				BlkioDeviceWriteIOps: []throttleDevice{{Path: "/dev/sda", Rate: 100}},
+			},
+			want: []string{
+				"--memory=1073741824",
+				"--cpu-shares=512",
+				"--memory-swappiness=0",
+				"--oom-kill-disable",
+				"--cpuset-cpus=0-1",
+				"--blkio-weight-device=/dev/sda:200",
+				"--device-write-iops=/dev/sda:100",
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := runArgs(&tt.rc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRunCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   runtimeConfig
+		want string
+	}{
+		{
+			name: "image command",
+			rc:   runtimeConfig{Image: "cts/app:1.0"},
+			want: "docker run \\\n  cts/app:1.0\n",
+		},
+		{
+			name: "entrypoint only",
+			rc:   runtimeConfig{Image: "cts/app:1.0", Args: []string{"/bin/app"}, ReadOnly: true},
+			want: "docker run \\\n  --read-only \\\n  --entrypoint=/bin/app \\\n  cts/app:1.0\n",
+		},
+		{
+			name: "arguments",
+			rc: runtimeConfig{
+				Image:   "cts/app:1.0",
+				Args:    []string{"/bin/sh", "-c", "echo 'hi' $HOME"},
+				Sysctls: map[string]string{"kernel.domainname": "example com"},
+			},
+			want: "docker run \\\n  '--sysctl=kernel.domainname=example com' \\\n  --entrypoint=/bin/sh \\\n  cts/app:1.0 -c 'echo '\\''hi'\\'' $HOME'\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := string(formatRunCommand(&tt.rc)); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"--memory=1g":                  "--memory=1g",
+		"cts/app@sha256:ab12":          "cts/app@sha256:ab12",
+		"":                             "''",
+		"a b":                          "'a b'",
+		"it's":                         `'it'\''s'`,
+		"$HOME":                        "'$HOME'",
+		"--device-cgroup-rule=c *:* m": "'--device-cgroup-rule=c *:* m'",
+	} {
+		if got := shellQuote(s); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
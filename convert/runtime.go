@@ -0,0 +1,412 @@
+package convert
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// RuntimeFormat selects what the runtime command writes.
+type RuntimeFormat string
+
+const (
+	// RuntimeRun writes a docker run command line.
+	RuntimeRun RuntimeFormat = "run"
+	// RuntimeHostConfig writes the HostConfig of a Docker Engine API
+	// container create request as JSON.
+	RuntimeHostConfig RuntimeFormat = "hostconfig"
+	// RuntimeCompose writes a docker-compose.yml service.
+	RuntimeCompose RuntimeFormat = "compose"
+	// RuntimeKubernetes writes a Kubernetes Pod manifest.
+	RuntimeKubernetes RuntimeFormat = "k8s"
+	// RuntimeKubernetesDeployment writes a Kubernetes Deployment manifest
+	// with a single replica.
+	RuntimeKubernetesDeployment RuntimeFormat = "k8s-deployment"
+)
+
+// target names what a runtime format is read by, in reports of settings it
+// cannot express.
+func (f RuntimeFormat) target() string {
+	switch f {
+	case RuntimeKubernetes, RuntimeKubernetesDeployment:
+		return "Kubernetes"
+	}
+	return "Docker"
+}
+
+// ParseRuntimeFormat checks the runtime output format named on the command
+// line.
+func ParseRuntimeFormat(name string) (RuntimeFormat, error) {
+	switch f := RuntimeFormat(name); f {
+	case RuntimeRun, RuntimeHostConfig, RuntimeCompose, RuntimeKubernetes, RuntimeKubernetesDeployment:
+		return f, nil
+	case "":
+		return RuntimeCompose, nil
+	}
+	return "", fmt.Errorf("unknown runtime format %q, expected run, hostconfig, compose, k8s or k8s-deployment", name)
+}
+
+// defaultShmSize is the size of /dev/shm in Docker containers.
+const defaultShmSize = 64 << 20
+
+// dockerMounts are the mounts Docker sets up in every container by itself.
+// Bundle mounts of the same type on these destinations are left out.
+var dockerMounts = map[string]string{
+	"/proc":          "proc",
+	"/dev":           "tmpfs",
+	"/dev/pts":       "devpts",
+	"/dev/shm":       "tmpfs",
+	"/dev/mqueue":    "mqueue",
+	"/sys":           "sysfs",
+	"/sys/fs/cgroup": "cgroup",
+}
+
+// runtimeConfig is how a container of the converted image has to be run to
+// behave like the bundle: the docker run settings its config.json maps to.
+type runtimeConfig struct {
+	Image    string
+	Args     []string
+	Env      []string
+	Cwd      string
+	User     specs.User
+	Hostname string
+	Tty      bool
+	ReadOnly bool
+	Mounts   []runtimeMount
+	ShmSize  int64
+	CapAdd   []string
+	CapDrop  []string
+	Ulimits  []ulimit
+	Devices  []deviceMapping
+	// DeviceCgroupRules are the device cgroup rules beyond Devices.
+	DeviceCgroupRules []string
+	Sysctls           map[string]string
+
+	// The namespace modes are host, none for the network, private for
+	// the cgroup namespace, or empty for Docker's default.
+	NetworkMode  string
+	PidMode      string
+	IpcMode      string
+	UTSMode      string
+	UsernsMode   string
+	CgroupnsMode string
+
+	// ApparmorProfile and SelinuxLabel confine the process, when set.
+	ApparmorProfile string
+	SelinuxLabel    *selinuxLabel
+	NoNewPrivileges bool
+
+	Memory               int64
+	MemoryReservation    int64
+	MemorySwap           int64
+	KernelMemory         int64
+	MemorySwappiness     *int64
+	OomKillDisable       bool
+	OomScoreAdj          int
+	CPUShares            int64
+	CPUQuota             int64
+	CPUPeriod            int64
+	CPURealtimeRuntime   int64
+	CPURealtimePeriod    int64
+	CpusetCpus           string
+	CpusetMems           string
+	PidsLimit            int64
+	BlkioWeight          uint16
+	BlkioWeightDevice    []weightDevice
+	BlkioDeviceReadBps   []throttleDevice
+	BlkioDeviceWriteBps  []throttleDevice
+	BlkioDeviceReadIOps  []throttleDevice
+	BlkioDeviceWriteIOps []throttleDevice
+
+	// Unsupported lists the bundle settings a container of the image
+	// cannot reproduce.
+	Unsupported []string
+}
+
+// runtimeMount is a bind mount, tmpfs or volume of the container. A volume
+// has no source: it is an anonymous volume that Docker fills with the
+// content of the image at its target.
+type runtimeMount struct {
+	Type        string
+	Source      string
+	Target      string
+	ReadOnly    bool
+	Propagation string
+	// Options are the tmpfs mount options.
+	Options []string
+}
+
+type ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// deviceMapping is a host device made available in the container.
+type deviceMapping struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
+}
+
+func (d deviceMapping) String() string {
+	return d.PathOnHost + ":" + d.PathInContainer + ":" + d.CgroupPermissions
+}
+
+// newRuntimeConfig maps the runtime settings of spec for a container of the
+// first image name of opts. stat looks up paths in the root filesystem of
+// the bundle; it is nil when that is unknown.
+func newRuntimeConfig(spec *specs.Spec, stat rootfsStat, opts Options) (*runtimeConfig, error) {
+	rc := &runtimeConfig{
+		Image:    opts.ImageNames[0],
+		Args:     spec.Process.Args,
+		Env:      spec.Process.Env,
+		Cwd:      spec.Process.Cwd,
+		User:     spec.Process.User,
+		Hostname: spec.Hostname,
+		Tty:      spec.Process.Terminal,
+		ReadOnly: spec.Root.Readonly,
+	}
+	rc.mapMounts(spec.Mounts)
+	rc.mapPaths(spec, stat)
+	if err := rc.mapNamespaces(spec); err != nil {
+		return nil, err
+	}
+
+	if err := rc.mapSecurity(spec); err != nil {
+		return nil, err
+	}
+	if spec.Process.Capabilities != nil {
+		var err error
+		rc.CapAdd, rc.CapDrop, err = diffCapabilities(spec.Process.Capabilities)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rc.mapRlimits(spec.Process.Rlimits); err != nil {
+		return nil, err
+	}
+	if err := rc.mapDevices(spec, opts.AllowAllDevices); err != nil {
+		return nil, err
+	}
+	if err := rc.mapSysctls(spec.Linux.Sysctl); err != nil {
+		return nil, err
+	}
+	if r := spec.Linux.Resources; r != nil {
+		rc.mapResources(r)
+	}
+	return rc, nil
+}
+
+func (rc *runtimeConfig) unsupported(format string, args ...interface{}) {
+	rc.Unsupported = append(rc.Unsupported, fmt.Sprintf(format, args...))
+}
+
+func (rc *runtimeConfig) mapMounts(mounts []specs.Mount) {
+	for _, m := range mounts {
+		if typ, ok := dockerMounts[m.Destination]; ok && typ == m.Type {
+			if m.Destination == "/dev/shm" {
+				if size, ok := mountSize(m.Options); ok && size != defaultShmSize {
+					rc.ShmSize = size
+				}
+			}
+			continue
+		}
+		rm := runtimeMount{Target: m.Destination, Source: m.Source}
+		bind := m.Type == "bind"
+		for _, o := range m.Options {
+			switch o {
+			case "bind", "rbind":
+				bind = true
+			case "ro":
+				rm.ReadOnly = true
+			case "rw":
+			case "shared", "rshared", "slave", "rslave", "private", "rprivate":
+				rm.Propagation = o
+			default:
+				rm.Options = append(rm.Options, o)
+			}
+		}
+		switch {
+		case bind:
+			rm.Type, rm.Options = "bind", nil
+		case m.Type == "tmpfs":
+			rm.Type, rm.Source = "tmpfs", ""
+			if rm.ReadOnly {
+				rm.Options = append([]string{"ro"}, rm.Options...)
+			}
+		default:
+			rc.unsupported("%s mount on %s", m.Type, m.Destination)
+			continue
+		}
+		rc.Mounts = append(rc.Mounts, rm)
+	}
+}
+
+// mountSize reads the size= option of a tmpfs mount.
+func mountSize(options []string) (int64, bool) {
+	for _, o := range options {
+		if strings.HasPrefix(o, "size=") {
+			size, err := parseSize(o[len("size="):])
+			return size, err == nil
+		}
+	}
+	return 0, false
+}
+
+// parseSize reads a size with an optional k, m or g suffix.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+	mult := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		mult = 1 << 10
+	case "m":
+		mult = 1 << 20
+	case "g":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mult, nil
+}
+
+func int64Value(v *uint64) int64 {
+	if v == nil {
+		return 0
+	}
+	return int64(*v)
+}
+
+// serviceName derives a compose service or Kubernetes object name from an
+// image reference.
+func serviceName(image string) string {
+	r, err := parseReference(image)
+	if err != nil {
+		return "app"
+	}
+	if name := dnsLabel(path.Base(r.path)); name != "" {
+		return name
+	}
+	return "app"
+}
+
+// dnsLabel turns s into a lowercase RFC 1123 label, the syntax of names in
+// compose files and Kubernetes.
+func dnsLabel(s string) string {
+	name := strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' {
+			return c
+		}
+		if c >= 'A' && c <= 'Z' {
+			return c - 'A' + 'a'
+		}
+		return '-'
+	}, s)
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return strings.Trim(name, "-")
+}
+
+// bundleRootfsStat returns the rootfsStat of the root filesystem of the
+// bundle at path. The rootfs of a bundle archive is indexed, since it is
+// never extracted.
+func bundleRootfsStat(path string, spec *specs.Spec, opts Options) (rootfsStat, error) {
+	if opts.archive != nil {
+		a, err := newArchiver(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := a.indexRootfs()
+		if err != nil {
+			return nil, fmt.Errorf("reading the rootfs: %v", err)
+		}
+		return idx.stat, nil
+	}
+	rootfs := spec.Root.Path
+	if !filepath.IsAbs(rootfs) {
+		rootfs = filepath.Join(path, rootfs)
+	}
+	return dirStat(rootfs), nil
+}
+
+// RunRuntime writes how to run the image converted from the bundle at path
+// so that it behaves like the bundle, in format, to output or stdout.
+func RunRuntime(path string, format RuntimeFormat, output string, opts Options) {
+	setLogLevel(opts.Debug)
+
+	path, archive, err := openBundle(path)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	if archive != nil {
+		defer archive.Close()
+		opts.archive = archive
+	}
+	if err := tagImageNames(path, &opts); err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	spec := getConfigSpec(path)
+	if spec == nil {
+		logrus.Infof("%v", ErrNoConfig)
+		return
+	}
+
+	stat, err := bundleRootfsStat(path, spec, opts)
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	rc, err := newRuntimeConfig(spec, stat, opts)
+	if err != nil {
+		logrus.Infof("Runtime configuration failed: %v", err)
+		return
+	}
+
+	var data []byte
+	switch format {
+	case RuntimeRun:
+		data = formatRunCommand(rc)
+	case RuntimeHostConfig:
+		data, err = marshalReport(newHostConfig(rc), ReportJSON)
+	case RuntimeCompose:
+		data, err = marshalYAML(newComposeFile(rc))
+	case RuntimeKubernetes:
+		data, err = marshalYAML(newKubernetesPod(rc))
+	case RuntimeKubernetesDeployment:
+		data, err = marshalYAML(newKubernetesDeployment(rc))
+	}
+	for _, u := range rc.Unsupported {
+		logrus.Warnf("Not expressible in %s: %s.", format.target(), u)
+	}
+	if err != nil {
+		logrus.Infof("Runtime configuration failed: %v", err)
+		return
+	}
+	if output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := ioutil.WriteFile(output, data, 0644); err != nil {
+		logrus.Infof("Write runtime configuration failed: %v", err)
+		return
+	}
+	logrus.Infof("Runtime configuration written to %s.", output)
+}
@@ -0,0 +1,140 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestParseRuntimeFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want RuntimeFormat
+		err  string
+	}{
+		{name: "", want: RuntimeCompose},
+		{name: "run", want: RuntimeRun},
+		{name: "hostconfig", want: RuntimeHostConfig},
+		{name: "k8s-deployment", want: RuntimeKubernetesDeployment},
+		{name: "swarm", err: `unknown runtime format "swarm"`},
+	}
+	for _, tt := range tests {
+		got, err := ParseRuntimeFormat(tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseRuntimeFormat(%q): got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRuntimeFormat(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestMapMounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		mounts      []specs.Mount
+		want        []runtimeMount
+		shmSize     int64
+		unsupported []string
+	}{
+		{
+			name: "docker mounts",
+			mounts: []specs.Mount{
+				{Destination: "/proc", Type: "proc", Source: "proc"},
+				{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "mode=755"}},
+				{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"size=65536k"}},
+				{Destination: "/sys/fs/cgroup", Type: "cgroup", Source: "cgroup"},
+			},
+		},
+		{
+			name:    "shm size",
+			mounts:  []specs.Mount{{Destination: "/dev/shm", Type: "tmpfs", Options: []string{"nosuid", "size=1g"}}},
+			shmSize: 1 << 30,
+		},
+		{
+			name: "binds",
+			mounts: []specs.Mount{
+				{Destination: "/data", Type: "bind", Source: "/srv/data", Options: []string{"rbind", "ro", "rslave"}},
+				{Destination: "/cache", Type: "none", Source: "/var/cache", Options: []string{"bind", "rw", "nosuid"}},
+			},
+			want: []runtimeMount{
+				{Type: "bind", Source: "/srv/data", Target: "/data", ReadOnly: true, Propagation: "rslave"},
+				{Type: "bind", Source: "/var/cache", Target: "/cache"},
+			},
+		},
+		{
+			name: "tmpfs",
+			mounts: []specs.Mount{
+				{Destination: "/tmp", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "size=64m"}},
+				{Destination: "/run", Type: "tmpfs", Source: "tmpfs", Options: []string{"ro", "mode=755"}},
+			},
+			want: []runtimeMount{
+				{Type: "tmpfs", Target: "/tmp", Options: []string{"nosuid", "size=64m"}},
+				{Type: "tmpfs", Target: "/run", ReadOnly: true, Options: []string{"ro", "mode=755"}},
+			},
+		},
+		{
+			name: "other types",
+			mounts: []specs.Mount{
+				{Destination: "/host/proc", Type: "proc", Source: "proc"},
+				{Destination: "/mnt", Type: "nfs", Source: "server:/export"},
+			},
+			unsupported: []string{"proc mount on /host/proc", "nfs mount on /mnt"},
+		},
+	}
+	for _, tt := range tests {
+		rc := &runtimeConfig{}
+		rc.mapMounts(tt.mounts)
+		if !reflect.DeepEqual(rc.Mounts, tt.want) {
+			t.Errorf("%s: got mounts %+v, want %+v", tt.name, rc.Mounts, tt.want)
+		}
+		if rc.ShmSize != tt.shmSize {
+			t.Errorf("%s: got shm size %d, want %d", tt.name, rc.ShmSize, tt.shmSize)
+		}
+		if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+			t.Errorf("%s: got unsupported %q, want %q", tt.name, rc.Unsupported, tt.unsupported)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		err  bool
+	}{
+		{s: "512", want: 512},
+		{s: "64k", want: 64 << 10},
+		{s: "2M", want: 2 << 20},
+		{s: "1g", want: 1 << 30},
+		{s: "", err: true},
+		{s: "m", err: true},
+		{s: "1.5g", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestServiceName(t *testing.T) {
+	for image, want := range map[string]string{
+		"busybox:latest": "busybox",
+		"registry.example.com:5000/team/my_app:1.0": "my-app",
+		"cts/app@sha256:" + strings.Repeat("a", 64): "app",
+		"localhost/" + strings.Repeat("x", 70):      strings.Repeat("x", 63),
+		"Invalid Reference":                         "app",
+		"cts/___":                                   "app",
+	} {
+		if got := serviceName(image); got != want {
+			t.Errorf("serviceName(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
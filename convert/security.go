@@ -0,0 +1,99 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// The syntax of SELinux context components.
+var (
+	selinuxName  = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+	selinuxLevel = regexp.MustCompile(`^s[0-9]+(-s[0-9]+)?(:c[0-9]+([.,]c[0-9]+)*)?$`)
+	apparmorName = regexp.MustCompile(`^[^\s,=]+$`)
+)
+
+// selinuxLabel is an SELinux context, user:role:type:level.
+type selinuxLabel struct {
+	User  string
+	Role  string
+	Type  string
+	Level string
+}
+
+func (l selinuxLabel) String() string {
+	return l.User + ":" + l.Role + ":" + l.Type + ":" + l.Level
+}
+
+// parseSELinuxLabel parses and validates an SELinux context. The level is
+// optional and may itself contain colons, as in s0:c1,c2.
+func parseSELinuxLabel(s string) (selinuxLabel, error) {
+	var l selinuxLabel
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) < 3 {
+		return l, fmt.Errorf("invalid SELinux label %q: expected user:role:type:level", s)
+	}
+	l.User, l.Role, l.Type = parts[0], parts[1], parts[2]
+	if len(parts) == 4 {
+		l.Level = parts[3]
+	}
+	for _, c := range []struct{ name, value string }{
+		{"user", l.User}, {"role", l.Role}, {"type", l.Type},
+	} {
+		if !selinuxName.MatchString(c.value) {
+			return l, fmt.Errorf("invalid SELinux label %q: invalid %s %q", s, c.name, c.value)
+		}
+	}
+	if l.Level != "" && !selinuxLevel.MatchString(l.Level) {
+		return l, fmt.Errorf("invalid SELinux label %q: invalid level %q", s, l.Level)
+	}
+	return l, nil
+}
+
+// mapSecurity maps the AppArmor profile, the SELinux labels and
+// noNewPrivileges of the bundle.
+func (rc *runtimeConfig) mapSecurity(spec *specs.Spec) error {
+	rc.NoNewPrivileges = spec.Process.NoNewPrivileges
+	if p := spec.Process.ApparmorProfile; p != "" {
+		if !apparmorName.MatchString(p) {
+			return fmt.Errorf("invalid AppArmor profile %q", p)
+		}
+		rc.ApparmorProfile = p
+	}
+	if s := spec.Process.SelinuxLabel; s != "" {
+		l, err := parseSELinuxLabel(s)
+		if err != nil {
+			return err
+		}
+		rc.SelinuxLabel = &l
+	}
+	if s := spec.Linux.MountLabel; s != "" {
+		if _, err := parseSELinuxLabel(s); err != nil {
+			return fmt.Errorf("mount label: %v", err)
+		}
+		// The files of the container are labeled with the file type
+		// matching the process label.
+		rc.unsupported("mount label %s, which is derived from the process label", s)
+	}
+	return nil
+}
+
+// securityOpts returns the --security-opt values of rc.
+func (rc *runtimeConfig) securityOpts() []string {
+	var opts []string
+	if rc.ApparmorProfile != "" {
+		opts = append(opts, "apparmor="+rc.ApparmorProfile)
+	}
+	if l := rc.SelinuxLabel; l != nil {
+		opts = append(opts, "label=user:"+l.User, "label=role:"+l.Role, "label=type:"+l.Type)
+		if l.Level != "" {
+			opts = append(opts, "label=level:"+l.Level)
+		}
+	}
+	if rc.NoNewPrivileges {
+		opts = append(opts, "no-new-privileges")
+	}
+	return opts
+}
@@ -0,0 +1,108 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestParseSELinuxLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  selinuxLabel
+		err   string
+	}{
+		{label: "system_u:system_r:container_t:s0", want: selinuxLabel{"system_u", "system_r", "container_t", "s0"}},
+		{label: "system_u:system_r:container_t:s0:c1,c2", want: selinuxLabel{"system_u", "system_r", "container_t", "s0:c1,c2"}},
+		{label: "user_u:user_r:user_t:s0-s15:c0.c1023", want: selinuxLabel{"user_u", "user_r", "user_t", "s0-s15:c0.c1023"}},
+		{label: "system_u:system_r:container_t", want: selinuxLabel{"system_u", "system_r", "container_t", ""}},
+		{label: "", err: "expected user:role:type:level"},
+		{label: "container_t", err: "expected user:role:type:level"},
+		{label: "system_u:system_r", err: "expected user:role:type:level"},
+		{label: ":system_r:container_t:s0", err: `invalid user ""`},
+		{label: "system_u:sys tem_r:container_t:s0", err: `invalid role "sys tem_r"`},
+		{label: "system_u:system_r:container-t:s0", err: `invalid type "container-t"`},
+		{label: "system_u:system_r:container_t:c0", err: `invalid level "c0"`},
+		{label: "system_u:system_r:container_t:s0:c1;reboot", err: `invalid level "s0:c1;reboot"`},
+		{label: "system_u:system_r:container_t:s0,level:s1", err: "invalid level"},
+	}
+	for _, tt := range tests {
+		got, err := parseSELinuxLabel(tt.label)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseSELinuxLabel(%q): got error %v, want %q", tt.label, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSELinuxLabel(%q) = %+v, %v, want %+v", tt.label, got, err, tt.want)
+		}
+	}
+}
+
+func TestMapSecurity(t *testing.T) {
+	tests := []struct {
+		name            string
+		apparmor        string
+		label           string
+		mountLabel      string
+		noNewPrivileges bool
+		opts            []string
+		unsupported     []string
+		err             string
+	}{
+		{name: "none"},
+		{
+			name:            "all",
+			apparmor:        "docker-default",
+			label:           "system_u:system_r:container_t:s0:c1,c2",
+			noNewPrivileges: true,
+			opts: []string{
+				"apparmor=docker-default",
+				"label=user:system_u", "label=role:system_r", "label=type:container_t", "label=level:s0:c1,c2",
+				"no-new-privileges",
+			},
+		},
+		{
+			name:  "label without level",
+			label: "system_u:system_r:spc_t",
+			opts:  []string{"label=user:system_u", "label=role:system_r", "label=type:spc_t"},
+		},
+		{
+			name:        "mount label",
+			mountLabel:  "system_u:object_r:container_file_t:s0",
+			unsupported: []string{"mount label system_u:object_r:container_file_t:s0, which is derived from the process label"},
+		},
+		{name: "invalid apparmor profile", apparmor: "docker-default,label=disable", err: "invalid AppArmor profile"},
+		{name: "invalid label", label: "system_u:system_r", err: "invalid SELinux label"},
+		{name: "invalid mount label", mountLabel: "object_r:container_file_t", err: "mount label: invalid SELinux label"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &specs.Spec{}
+			spec.Process.ApparmorProfile = tt.apparmor
+			spec.Process.SelinuxLabel = tt.label
+			spec.Process.NoNewPrivileges = tt.noNewPrivileges
+			spec.Linux.MountLabel = tt.mountLabel
+			rc := &runtimeConfig{}
+			err := rc.mapSecurity(spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rc.securityOpts(); !reflect.DeepEqual(got, tt.opts) {
+				t.Errorf("got security options %q, want %q", got, tt.opts)
+			}
+			if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+				t.Errorf("got unsupported %q, want %q", rc.Unsupported, tt.unsupported)
+			}
+		})
+	}
+}
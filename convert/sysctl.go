@@ -0,0 +1,127 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// sysctlKey is the syntax of a sysctl name, dotted or as a path below
+// /proc/sys.
+var sysctlKey = regexp.MustCompile(`^[a-z0-9_-]+([./][a-zA-Z0-9_:+-]+)+$`)
+
+// sysctlClass tells how a sysctl behaves in a container.
+type sysctlClass int
+
+const (
+	// sysctlNamespaced sysctls belong to a namespace and are safe to set
+	// when the container has a namespace of its own.
+	sysctlNamespaced sysctlClass = iota
+	// sysctlHost sysctls are not namespaced, so they can only be set for
+	// the host as a whole. Docker refuses them.
+	sysctlHost
+	// sysctlDisallowed sysctls are set through other settings.
+	sysctlDisallowed
+)
+
+// namespacedSysctls are the sysctls Docker accepts, by the namespace they
+// belong to. Names ending in a dot or an asterisk are prefixes.
+var namespacedSysctls = []struct {
+	name string
+	ns   specs.NamespaceType
+}{
+	{"net.", specs.NetworkNamespace},
+	{"kernel.shm*", specs.IPCNamespace},
+	{"kernel.msg*", specs.IPCNamespace},
+	{"kernel.sem", specs.IPCNamespace},
+	{"fs.mqueue.", specs.IPCNamespace},
+	{"kernel.domainname", specs.UTSNamespace},
+}
+
+// classifySysctl returns the class of sysctl key and, for a namespaced
+// one, its namespace.
+func classifySysctl(key string) (sysctlClass, specs.NamespaceType) {
+	if key == "kernel.hostname" {
+		return sysctlDisallowed, ""
+	}
+	for _, s := range namespacedSysctls {
+		switch {
+		case strings.HasSuffix(s.name, "*") && strings.HasPrefix(key, strings.TrimSuffix(s.name, "*")),
+			strings.HasSuffix(s.name, ".") && strings.HasPrefix(key, s.name),
+			key == s.name:
+			return sysctlNamespaced, s.ns
+		}
+	}
+	return sysctlHost, ""
+}
+
+// dottedSysctl returns the dotted form of sysctl key. In the form of paths
+// below /proc/sys dots and slashes trade places, as with sysctl(8).
+func dottedSysctl(key string) string {
+	if !strings.Contains(key, "/") {
+		return key
+	}
+	return strings.Map(func(c rune) rune {
+		switch c {
+		case '/':
+			return '.'
+		case '.':
+			return '/'
+		}
+		return c
+	}, key)
+}
+
+// privateNamespace reports whether the namespace mode of Docker gives the
+// container a namespace of its own.
+func privateNamespace(mode string) bool {
+	switch mode {
+	case "", "none", "private", "shareable":
+		return true
+	}
+	return false
+}
+
+// mapSysctls maps linux.sysctl to the sysctls of the container, by their
+// dotted names. Only namespaced sysctls of a namespace the container has
+// to itself are kept; the others would fail, change the host or change
+// another container.
+func (rc *runtimeConfig) mapSysctls(sysctls map[string]string) error {
+	modes := map[specs.NamespaceType]string{
+		specs.NetworkNamespace: rc.NetworkMode,
+		specs.IPCNamespace:     rc.IpcMode,
+		specs.UTSNamespace:     rc.UTSMode,
+	}
+	var keys []string
+	for key := range sysctls {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := sysctls[key]
+		if !sysctlKey.MatchString(key) {
+			return fmt.Errorf("invalid sysctl name %q", key)
+		}
+		key = dottedSysctl(key)
+		class, ns := classifySysctl(key)
+		switch {
+		case class == sysctlDisallowed:
+			rc.unsupported("sysctl %s, which is set by the hostname", key)
+		case class == sysctlHost:
+			rc.unsupported("sysctl %s=%s, which is not namespaced and would change the host", key, value)
+		case modes[ns] == "host":
+			rc.unsupported("sysctl %s=%s in the %s namespace of the host", key, value, ns)
+		case !privateNamespace(modes[ns]):
+			rc.unsupported("sysctl %s=%s in the %s namespace of %s", key, value, ns, modes[ns])
+		default:
+			if rc.Sysctls == nil {
+				rc.Sysctls = make(map[string]string)
+			}
+			rc.Sysctls[key] = value
+		}
+	}
+	return nil
+}
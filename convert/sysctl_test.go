@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+func TestClassifySysctl(t *testing.T) {
+	tests := []struct {
+		key   string
+		class sysctlClass
+		ns    specs.NamespaceType
+	}{
+		{"net.ipv4.ip_forward", sysctlNamespaced, specs.NetworkNamespace},
+		{"net.core.somaxconn", sysctlNamespaced, specs.NetworkNamespace},
+		{"kernel.shmmax", sysctlNamespaced, specs.IPCNamespace},
+		{"kernel.shm_rmid_forced", sysctlNamespaced, specs.IPCNamespace},
+		{"kernel.msgmnb", sysctlNamespaced, specs.IPCNamespace},
+		{"kernel.sem", sysctlNamespaced, specs.IPCNamespace},
+		{"fs.mqueue.msg_max", sysctlNamespaced, specs.IPCNamespace},
+		{"kernel.domainname", sysctlNamespaced, specs.UTSNamespace},
+		{"kernel.hostname", sysctlDisallowed, ""},
+		{"kernel.semaphore", sysctlHost, ""},
+		{"kernel.pid_max", sysctlHost, ""},
+		{"vm.swappiness", sysctlHost, ""},
+		{"fs.file-max", sysctlHost, ""},
+		{"network.x", sysctlHost, ""},
+		{"fs.mqueue", sysctlHost, ""},
+	}
+	for _, tt := range tests {
+		class, ns := classifySysctl(tt.key)
+		if class != tt.class || ns != tt.ns {
+			t.Errorf("classifySysctl(%q) = %v, %q, want %v, %q", tt.key, class, ns, tt.class, tt.ns)
+		}
+	}
+}
+
+func TestMapSysctls(t *testing.T) {
+	tests := []struct {
+		name        string
+		sysctls     map[string]string
+		networkMode string
+		want        map[string]string
+		unsupported []string
+		err         string
+	}{
+		{name: "none"},
+		{
+			name: "namespaced",
+			sysctls: map[string]string{
+				"net.ipv4.ip_forward":     "1",
+				"net/ipv4/tcp_syncookies": "0",
+				"kernel.shmmax":           "68719476736",
+			},
+			want: map[string]string{
+				"net.ipv4.ip_forward":     "1",
+				"net.ipv4.tcp_syncookies": "0",
+				"kernel.shmmax":           "68719476736",
+			},
+		},
+		{
+			name: "host sysctls",
+			sysctls: map[string]string{
+				"vm.swappiness":       "10",
+				"kernel.hostname":     "box",
+				"net.ipv4.ip_forward": "1",
+			},
+			want: map[string]string{"net.ipv4.ip_forward": "1"},
+			unsupported: []string{
+				"sysctl kernel.hostname, which is set by the hostname",
+				"sysctl vm.swappiness=10, which is not namespaced and would change the host",
+			},
+		},
+		{
+			name:        "host network namespace",
+			sysctls:     map[string]string{"net.ipv4.ip_forward": "1", "kernel.msgmax": "65536"},
+			networkMode: "host",
+			want:        map[string]string{"kernel.msgmax": "65536"},
+			unsupported: []string{"sysctl net.ipv4.ip_forward=1 in the network namespace of the host"},
+		},
+		{
+			name:        "slashes",
+			sysctls:     map[string]string{"net/ipv4/conf/eth0.100/rp_filter": "2"},
+			networkMode: "none",
+			want:        map[string]string{"net.ipv4.conf.eth0/100.rp_filter": "2"},
+		},
+		{
+			name:        "container network namespace",
+			sysctls:     map[string]string{"net.ipv4.ip_forward": "1", "kernel.msgmax": "65536"},
+			networkMode: "container:0123abcd",
+			want:        map[string]string{"kernel.msgmax": "65536"},
+			unsupported: []string{"sysctl net.ipv4.ip_forward=1 in the network namespace of container:0123abcd"},
+		},
+		{
+			name:    "invalid name",
+			sysctls: map[string]string{"net.ipv4.ip_forward": "1", "net..bad": "1"},
+			err:     `invalid sysctl name "net..bad"`,
+		},
+		{
+			name:    "single component",
+			sysctls: map[string]string{"kernel": "1"},
+			err:     `invalid sysctl name "kernel"`,
+		},
+		{
+			name:    "option injection",
+			sysctls: map[string]string{"net.ipv4.ip_forward=1 --privileged": "1"},
+			err:     "invalid sysctl name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &runtimeConfig{NetworkMode: tt.networkMode}
+			err := rc.mapSysctls(tt.sysctls)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rc.Sysctls, tt.want) {
+				t.Errorf("got sysctls %v, want %v", rc.Sysctls, tt.want)
+			}
+			if !reflect.DeepEqual(rc.Unsupported, tt.unsupported) {
+				t.Errorf("got unsupported %q, want %q", rc.Unsupported, tt.unsupported)
+			}
+		})
+	}
+}
@@ -27,9 +27,9 @@ var (
 )
 
 type validateRes struct {
-	cfgOK   bool
-	rfsOK   bool
-	config  io.Reader
+	cfgOK  bool
+	rfsOK  bool
+	config io.Reader
 }
 
 func validateOCIProc(path string) bool {
@@ -61,6 +61,7 @@ func validateBundle(path string) error {
 		}
 		switch rpath {
 		case ".":
+		case IgnoreFile:
 		case ConfigFile:
 			res.config, err = os.Open(fpath)
 			if err != nil {
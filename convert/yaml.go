@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// marshalYAML renders v as block-style YAML. v is first encoded as JSON so
+// that the json tags and field order of the Go types are kept; the JSON
+// document is then rewritten token by token.
+func marshalYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeYAMLNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAMLNode(&buf, node, 0)
+	return buf.Bytes(), nil
+}
+
+// yamlMap is a JSON object with its keys in document order.
+type yamlMap struct {
+	keys   []string
+	values []interface{}
+}
+
+func decodeYAMLNode(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := &yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.keys = append(m.keys, key.(string))
+			m.values = append(m.values, value)
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+func writeYAMLNode(w io.Writer, node interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch n := node.(type) {
+	case *yamlMap:
+		for i, key := range n.keys {
+			fmt.Fprintf(w, "%s%s:", pad, yamlScalar(key))
+			writeYAMLValue(w, n.values[i], indent)
+		}
+	case []interface{}:
+		for _, value := range n {
+			fmt.Fprintf(w, "%s-", pad)
+			if m, ok := value.(*yamlMap); ok && len(m.keys) > 0 {
+				// Put the first key on the dash line.
+				var buf bytes.Buffer
+				writeYAMLNode(&buf, m, indent+1)
+				fmt.Fprintf(w, " %s", strings.TrimPrefix(buf.String(), pad+"  "))
+				continue
+			}
+			writeYAMLValue(w, value, indent)
+		}
+	}
+}
+
+// writeYAMLValue writes the value following a "key:" or "-", either inline
+// or as an indented block.
+func writeYAMLValue(w io.Writer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case *yamlMap:
+		if len(v.keys) == 0 {
+			fmt.Fprintln(w, " {}")
+			return
+		}
+		fmt.Fprintln(w)
+		writeYAMLNode(w, v, indent+1)
+	case []interface{}:
+		if len(v) == 0 {
+			fmt.Fprintln(w, " []")
+			return
+		}
+		fmt.Fprintln(w)
+		writeYAMLNode(w, v, indent+1)
+	default:
+		fmt.Fprintf(w, " %s\n", yamlScalar(v))
+	}
+}
+
+var (
+	yamlPlain    = regexp.MustCompile(`^[A-Za-z0-9_./][A-Za-z0-9_./@+=:-]*[A-Za-z0-9_./@+=-]$|^[A-Za-z0-9_./]$`)
+	yamlNumber   = regexp.MustCompile(`^[-+]?(\.?[0-9]|0[xo])`)
+	yamlReserved = map[string]bool{
+		"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+		"y": true, "n": true, "null": true, "~": true, ".inf": true, ".nan": true,
+	}
+)
+
+// yamlScalar formats a JSON scalar token. Strings that YAML would read as
+// anything else are double-quoted, which JSON string syntax is valid for.
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if yamlPlain.MatchString(v) && !yamlNumber.MatchString(v) && !yamlReserved[strings.ToLower(v)] {
+			return v
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,73 @@
+package convert
+
+import "testing"
+
+func TestMarshalYAML(t *testing.T) {
+	type item struct {
+		Name  string            `json:"name"`
+		Value interface{}       `json:"value,omitempty"`
+		Tags  map[string]string `json:"tags,omitempty"`
+	}
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{
+			name: "field order",
+			v: struct {
+				Zeta  int    `json:"zeta"`
+				Alpha string `json:"alpha"`
+			}{1, "a"},
+			want: "zeta: 1\nalpha: a\n",
+		},
+		{
+			name: "nested",
+			v: map[string]interface{}{
+				"items": []item{
+					{Name: "web", Value: 80, Tags: map[string]string{"tier": "front"}},
+					{Name: "db"},
+				},
+				"empty": map[string]string{},
+				"none":  []string{},
+				"list":  []string{"a", "b"},
+			},
+			want: "empty: {}\n" +
+				"items:\n" +
+				"  - name: web\n" +
+				"    value: 80\n" +
+				"    tags:\n" +
+				"      tier: front\n" +
+				"  - name: db\n" +
+				"list:\n" +
+				"  - a\n" +
+				"  - b\n" +
+				"none: []\n",
+		},
+		{
+			name: "scalars",
+			v: []interface{}{
+				"plain", "/bin/sh", "cts/app:1.0", "", "yes", "No", "null", "~",
+				"0755", "1.5", "-1", "0x1f", "a b", "key: value", "- item", "#comment",
+				"trailing:", "line\nbreak", `quote"`, true, nil, 1.5,
+			},
+			want: "- plain\n- /bin/sh\n- cts/app:1.0\n- \"\"\n- \"yes\"\n- \"No\"\n- \"null\"\n- \"~\"\n" +
+				"- \"0755\"\n- \"1.5\"\n- \"-1\"\n- \"0x1f\"\n- \"a b\"\n- \"key: value\"\n- \"- item\"\n- \"#comment\"\n" +
+				"- \"trailing:\"\n- \"line\\nbreak\"\n- \"quote\\\"\"\n- true\n- null\n- 1.5\n",
+		},
+	}
+	for _, tt := range tests {
+		got, err := marshalYAML(tt.v)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := marshalYAML(func() {}); err == nil {
+		t.Errorf("marshalYAML accepted a value JSON cannot encode")
+	}
+}
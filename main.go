@@ -8,6 +8,64 @@ import (
 	"github.com/huawei-openlab/oci2docker/convert"
 )
 
+// Flags of several commands, defined once so that they read the same in
+// every command.
+var (
+	bundleFlag = cli.StringFlag{
+		Name:  "oci-bundle",
+		Value: "",
+		Usage: "path of oci-bundle to convert, a directory or a tar archive (- for stdin)",
+	}
+	imageNamesFlag = cli.StringSliceFlag{
+		Name:  "image-name",
+		Value: &cli.StringSlice{},
+		Usage: "docker image name, with an optional tag; repeat to tag the image several times",
+	}
+	strictRootfsFlag = cli.BoolFlag{
+		Name:  "strict-rootfs",
+		Usage: "fail when the rootfs contains setuid files, escaping symlinks or unexpected devices",
+	}
+	templateFlag = cli.StringFlag{
+		Name:  "template",
+		Value: "",
+		Usage: "Go template file for the Dockerfile instead of the built-in one",
+	}
+	allowAllDevicesFlag = cli.BoolFlag{
+		Name:  "allow-all-devices",
+		Usage: "let the container access every host device when the bundle device rules allow it",
+	}
+	debugFlag = cli.BoolFlag{
+		Name:  "debug",
+		Usage: "debug messages switch, default false",
+	}
+
+	// bundleFlags are the flags of every command that reads the rootfs of
+	// a bundle.
+	bundleFlags = []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "port",
+			Value: &cli.StringSlice{},
+			Usage: "exposed port or port range of docker images, with /tcp or /udp; repeat for several",
+		},
+		cli.StringFlag{
+			Name:  "ignore-file",
+			Value: "",
+			Usage: "file of rootfs paths to exclude, default is .ociignore in the bundle",
+		},
+		cli.StringSliceFlag{
+			Name:  "uid-map",
+			Value: &cli.StringSlice{},
+			Usage: "containerID:hostID:size mapping of rootfs file owners, default from the bundle",
+		},
+		cli.StringSliceFlag{
+			Name:  "gid-map",
+			Value: &cli.StringSlice{},
+			Usage: "containerID:hostID:size mapping of rootfs file groups, default from the bundle",
+		},
+		debugFlag,
+	}
+)
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "oci2docker"
@@ -17,28 +75,124 @@ func main() {
 		{
 			Name:  "convert",
 			Usage: "format converting operation",
-			Flags: []cli.Flag{
-				cli.StringFlag{
+			Flags: append([]cli.Flag{
+				cli.StringSliceFlag{
 					Name:  "oci-bundle",
+					Value: &cli.StringSlice{},
+					Usage: "path of oci-bundle to convert, a directory or a tar archive (- for stdin); repeat for a multi-platform image",
+				},
+				imageNamesFlag,
+				cli.StringFlag{
+					Name:  "output",
 					Value: "",
-					Usage: "path of oci-bundle to convert",
+					Usage: "write the image to this OCI image layout directory instead of running docker build",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Value: "docker",
+					Usage: "manifest format of the written image: docker or oci",
+				},
+				cli.StringFlag{
+					Name:  "compression",
+					Value: "gzip",
+					Usage: "layer compression of the written image: gzip, zstd or none",
+				},
+				cli.StringSliceFlag{
+					Name:  "push",
+					Value: &cli.StringSlice{},
+					Usage: "push the image to this registry reference instead of running docker build; repeat for several",
+				},
+				cli.StringSliceFlag{
+					Name:  "mount-from",
+					Value: &cli.StringSlice{},
+					Usage: "repository on the push registry to mount existing layers from",
 				},
 				cli.BoolFlag{
-					Name:  "debug",
-					Usage: "debug messages switch, default false",
+					Name:  "insecure-registry",
+					Usage: "push over plain HTTP, always done for localhost",
+				},
+				strictRootfsFlag,
+				templateFlag,
+			}, bundleFlags...),
+			Action: oci2docker,
+		},
+		{
+			Name:    "inspect",
+			Aliases: []string{"plan"},
+			Usage:   "print the image configuration a conversion would produce, without building",
+			Flags: append([]cli.Flag{
+				bundleFlag,
+				cli.StringFlag{
+					Name:  "format",
+					Value: "json",
+					Usage: "report format: json or yaml",
+				},
+			}, bundleFlags...),
+			Action: inspect,
+		},
+		{
+			Name:  "dockerfile",
+			Usage: "write a Dockerfile and rootfs build context instead of building",
+			Flags: append([]cli.Flag{
+				bundleFlag,
+				cli.StringFlag{
+					Name:  "output",
+					Value: "",
+					Usage: "directory to write the build context to, must not exist or be empty",
 				},
+				strictRootfsFlag,
+				templateFlag,
+			}, bundleFlags...),
+			Action: dockerfile,
+		},
+		{
+			Name:  "runtime",
+			Usage: "write how to run the converted image so that it behaves like the bundle",
+			Flags: []cli.Flag{
+				bundleFlag,
 				cli.StringFlag{
 					Name:  "image-name",
 					Value: "",
-					Usage: "docker image name",
+					Usage: "docker image name the bundle is converted to",
 				},
 				cli.StringFlag{
-					Name:  "port",
+					Name:  "format",
+					Value: "compose",
+					Usage: "runtime output format: run, hostconfig, compose, k8s or k8s-deployment",
+				},
+				cli.StringFlag{
+					Name:  "output",
 					Value: "",
-					Usage: "exposed port of docker images",
+					Usage: "file to write to, default stdout",
 				},
+				allowAllDevicesFlag,
+				debugFlag,
 			},
-			Action: oci2docker,
+			Action: runtime,
+		},
+		{
+			Name:  "create",
+			Usage: "convert the bundle and create a docker container with its runtime settings",
+			Flags: append([]cli.Flag{
+				bundleFlag,
+				imageNamesFlag,
+				cli.StringFlag{
+					Name:  "name",
+					Value: "",
+					Usage: "name of the container, default is a name chosen by docker",
+				},
+				cli.BoolFlag{
+					Name:  "start",
+					Usage: "start the container once created",
+				},
+				cli.BoolFlag{
+					Name:  "attach",
+					Usage: "start the container and attach to its standard streams until it exits",
+				},
+				allowAllDevicesFlag,
+				strictRootfsFlag,
+			}, bundleFlags...),
+			Action: create,
 		},
 	}
 
@@ -46,9 +200,7 @@ func main() {
 }
 
 func oci2docker(c *cli.Context) {
-	ociPath := c.String("oci-bundle")
-	imgName := c.String("image-name")
-	port := c.String("port")
+	ociPaths := c.StringSlice("oci-bundle")
 	flagDebug := c.Bool("debug")
 
 	if c.NumFlags() == 0 {
@@ -56,23 +208,308 @@ func oci2docker(c *cli.Context) {
 		return
 	}
 
-	if ociPath == "" {
+	if len(ociPaths) == 0 {
 		logrus.Infof("Please specify OCI bundle path.")
 		return
 	}
 
-	_, err := os.Stat(ociPath)
-	if os.IsNotExist(err) {
-		logrus.Infof("OCI bundle path does not exsit.")
-		return
+	for _, ociPath := range ociPaths {
+		if ociPath == "" {
+			logrus.Infof("Please specify OCI bundle path.")
+			return
+		}
+		if ociPath != "-" {
+			if _, err := os.Stat(ociPath); os.IsNotExist(err) {
+				logrus.Infof("OCI bundle path %s does not exsit.", ociPath)
+				return
+			}
+		}
 	}
 
-	if imgName == "" {
+	imgNames, err := convert.ParseImageNames(c.StringSlice("image-name"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	push, err := convert.ParseImageNames(c.StringSlice("push"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+	if len(imgNames) == 0 {
+		imgNames = push
+	}
+	if len(imgNames) == 0 {
 		logrus.Infof("Please specify docker image name for output.")
 		return
 	}
 
-	convert.RunOCI2Docker(ociPath, flagDebug, imgName, port)
+	ports, err := convert.ParsePorts(c.StringSlice("port"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	format, err := convert.ParseImageFormat(c.String("format"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	compression, err := convert.ParseCompression(c.String("compression"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	uidMappings, err := convert.ParseIDMappings(c.StringSlice("uid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	gidMappings, err := convert.ParseIDMappings(c.StringSlice("gid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	opts := convert.Options{
+		Debug:            flagDebug,
+		ImageNames:       imgNames,
+		Ports:            ports,
+		Output:           c.String("output"),
+		Format:           format,
+		Compression:      compression,
+		IgnoreFile:       c.String("ignore-file"),
+		UIDMappings:      uidMappings,
+		GIDMappings:      gidMappings,
+		StrictRootfs:     c.Bool("strict-rootfs"),
+		Push:             push,
+		MountFrom:        c.StringSlice("mount-from"),
+		InsecureRegistry: c.Bool("insecure-registry"),
+		Template:         c.String("template"),
+	}
+
+	if len(ociPaths) > 1 {
+		convert.RunOCI2DockerMultiArch(ociPaths, opts)
+	} else {
+		convert.RunOCI2Docker(ociPaths[0], opts)
+	}
 
 	return
 }
+
+func inspect(c *cli.Context) {
+	ociPath := c.String("oci-bundle")
+
+	if c.NumFlags() == 0 {
+		cli.ShowCommandHelp(c, "inspect")
+		return
+	}
+
+	if ociPath == "" {
+		logrus.Infof("Please specify OCI bundle path.")
+		return
+	}
+	if ociPath != "-" {
+		if _, err := os.Stat(ociPath); os.IsNotExist(err) {
+			logrus.Infof("OCI bundle path %s does not exsit.", ociPath)
+			return
+		}
+	}
+
+	ports, err := convert.ParsePorts(c.StringSlice("port"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	format, err := convert.ParseReportFormat(c.String("format"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	uidMappings, err := convert.ParseIDMappings(c.StringSlice("uid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	gidMappings, err := convert.ParseIDMappings(c.StringSlice("gid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	opts := convert.Options{
+		Debug:       c.Bool("debug"),
+		Ports:       ports,
+		IgnoreFile:  c.String("ignore-file"),
+		UIDMappings: uidMappings,
+		GIDMappings: gidMappings,
+	}
+
+	convert.RunInspect(ociPath, format, opts)
+}
+
+func dockerfile(c *cli.Context) {
+	ociPath := c.String("oci-bundle")
+	output := c.String("output")
+
+	if c.NumFlags() == 0 {
+		cli.ShowCommandHelp(c, "dockerfile")
+		return
+	}
+
+	if ociPath == "" {
+		logrus.Infof("Please specify OCI bundle path.")
+		return
+	}
+	if ociPath != "-" {
+		if _, err := os.Stat(ociPath); os.IsNotExist(err) {
+			logrus.Infof("OCI bundle path %s does not exsit.", ociPath)
+			return
+		}
+	}
+	if output == "" {
+		logrus.Infof("Please specify the build context directory for output.")
+		return
+	}
+
+	ports, err := convert.ParsePorts(c.StringSlice("port"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	uidMappings, err := convert.ParseIDMappings(c.StringSlice("uid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	gidMappings, err := convert.ParseIDMappings(c.StringSlice("gid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	opts := convert.Options{
+		Debug:        c.Bool("debug"),
+		Ports:        ports,
+		IgnoreFile:   c.String("ignore-file"),
+		UIDMappings:  uidMappings,
+		GIDMappings:  gidMappings,
+		StrictRootfs: c.Bool("strict-rootfs"),
+		Template:     c.String("template"),
+	}
+
+	convert.RunDockerfile(ociPath, output, opts)
+}
+
+func runtime(c *cli.Context) {
+	ociPath := c.String("oci-bundle")
+
+	if c.NumFlags() == 0 {
+		cli.ShowCommandHelp(c, "runtime")
+		return
+	}
+
+	if ociPath == "" {
+		logrus.Infof("Please specify OCI bundle path.")
+		return
+	}
+	if ociPath != "-" {
+		if _, err := os.Stat(ociPath); os.IsNotExist(err) {
+			logrus.Infof("OCI bundle path %s does not exsit.", ociPath)
+			return
+		}
+	}
+	if c.String("image-name") == "" {
+		logrus.Infof("Please specify docker image name.")
+		return
+	}
+
+	imgNames, err := convert.ParseImageNames([]string{c.String("image-name")})
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	format, err := convert.ParseRuntimeFormat(c.String("format"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		return
+	}
+
+	opts := convert.Options{
+		Debug:           c.Bool("debug"),
+		ImageNames:      imgNames,
+		AllowAllDevices: c.Bool("allow-all-devices"),
+	}
+
+	convert.RunRuntime(ociPath, format, c.String("output"), opts)
+}
+
+func create(c *cli.Context) {
+	ociPath := c.String("oci-bundle")
+
+	if c.NumFlags() == 0 {
+		cli.ShowCommandHelp(c, "create")
+		return
+	}
+
+	if ociPath == "" {
+		logrus.Infof("Please specify OCI bundle path.")
+		os.Exit(1)
+	}
+	if ociPath != "-" {
+		if _, err := os.Stat(ociPath); os.IsNotExist(err) {
+			logrus.Infof("OCI bundle path %s does not exsit.", ociPath)
+			os.Exit(1)
+		}
+	}
+
+	imgNames, err := convert.ParseImageNames(c.StringSlice("image-name"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		os.Exit(1)
+	}
+	if len(imgNames) == 0 {
+		logrus.Infof("Please specify docker image name.")
+		os.Exit(1)
+	}
+
+	ports, err := convert.ParsePorts(c.StringSlice("port"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		os.Exit(1)
+	}
+
+	uidMappings, err := convert.ParseIDMappings(c.StringSlice("uid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		os.Exit(1)
+	}
+
+	gidMappings, err := convert.ParseIDMappings(c.StringSlice("gid-map"))
+	if err != nil {
+		logrus.Infof("%v", err)
+		os.Exit(1)
+	}
+
+	opts := convert.Options{
+		Debug:           c.Bool("debug"),
+		ImageNames:      imgNames,
+		Ports:           ports,
+		IgnoreFile:      c.String("ignore-file"),
+		UIDMappings:     uidMappings,
+		GIDMappings:     gidMappings,
+		StrictRootfs:    c.Bool("strict-rootfs"),
+		AllowAllDevices: c.Bool("allow-all-devices"),
+	}
+
+	os.Exit(convert.RunCreate(ociPath, c.String("name"), c.Bool("start"), c.Bool("attach"), opts))
+}